@@ -0,0 +1,29 @@
+package fsp
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// LookupMAC find the hardware address of ip in the ARP table
+func LookupMAC(ip net.IP) (mac net.HardwareAddr, err error) {
+	var fp *os.File
+	fp, err = os.Open("/proc/net/arp")
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	var scanner = bufio.NewScanner(fp)
+	// IP address  HW type  Flags  HW address  Mask  Device
+	for scanner.Scan() {
+		var fields = strings.Fields(scanner.Text())
+		if len(fields) < 4 || !ip.Equal(net.ParseIP(fields[0])) {
+			continue
+		}
+		return net.ParseMAC(fields[3])
+	}
+	err = newKindError(ErrNotExist, "no ARP entry for "+ip.String())
+	return
+}
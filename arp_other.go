@@ -0,0 +1,12 @@
+//go:build !linux
+
+package fsp
+
+import "net"
+
+// LookupMAC find the hardware address of ip in the ARP table, only
+// supported on linux
+func LookupMAC(ip net.IP) (mac net.HardwareAddr, err error) {
+	err = newOpError("ARP table lookup not supported")
+	return
+}
@@ -0,0 +1,113 @@
+package fsp
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheItem one cached result, value is a *dir, os.FileInfo or protection byte
+type cacheItem struct {
+	value   interface{}
+	expires time.Time
+}
+
+// dirCache directory listings, stat and protection results of a session,
+// shared with forked sessions
+type dirCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]cacheItem // key is kind + cleaned path
+}
+
+// cache kinds
+const (
+	cacheDir  = "d:"
+	cacheStat = "s:"
+	cachePro  = "p:"
+)
+
+// SetCacheTTL keep directory listings, Stat and GetProtecion results for ttl,
+// 0 disable the cache. Mkdir, Remove, RemoveDir, Rename and uploads of this
+// session drop the affected entries, changes by other clients are seen after
+// ttl only.
+func (s *Session) SetCacheTTL(ttl time.Duration) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.cache.ttl = ttl
+	s.cache.items = nil
+}
+
+// cleanPath key of remote name, relative names are below root
+func cleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func (c *dirCache) get(kind, name string) (value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	var key = kind + cleanPath(name)
+	if item, ok := c.items[key]; ok {
+		if time.Now().Before(item.expires) {
+			return item.value
+		}
+		delete(c.items, key)
+	}
+	return
+}
+
+func (c *dirCache) put(kind, name string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	if c.items == nil {
+		c.items = make(map[string]cacheItem)
+	}
+	c.items[kind+cleanPath(name)] = cacheItem{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate drop name, everything below it and the listing of its parent
+func (c *dirCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.items) == 0 {
+		return
+	}
+	var clean = cleanPath(name)
+	var parent = path.Dir(clean)
+	for key := range c.items {
+		var p = key[len(cacheDir):]
+		if p == clean || strings.HasPrefix(p, clean+"/") || (key == cacheDir+parent) {
+			delete(c.items, key)
+		}
+	}
+}
+
+// cachedDir listing of dirName from cache, a copy is returned as dir keep
+// its read position
+func (s *Session) cachedDir(dirName string) (di *dir) {
+	if cached, ok := s.cache.get(cacheDir, dirName).(*dir); ok {
+		di = &dir{}
+		*di = *cached
+	}
+	return
+}
+
+func (s *Session) cachedStat(name string) (fi os.FileInfo) {
+	fi, _ = s.cache.get(cacheStat, name).(os.FileInfo)
+	return
+}
+
+// drop one cached result
+func (c *dirCache) drop(kind, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, kind+cleanPath(name))
+}
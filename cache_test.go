@@ -0,0 +1,59 @@
+package fsp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestCacheTTL(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.WriteFile("/pub/a.txt", []byte("a"), time.Now())
+	s.SetCacheTTL(time.Minute)
+	s.Readdir("/pub")
+	s.Stat("/pub/a.txt")
+	var requests = srv.Requests()
+	for i := 0; i < 3; i++ {
+		if _, err := s.Readdir("/pub"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Stat("/pub/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.Requests() - requests; n != 0 {
+		t.Errorf("%d requests for cached results", n)
+	}
+
+	// changes of this session drop the affected entries
+	if err := s.Remove("/pub/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if names := remoteNames(t, s, "/pub"); len(names) != 0 {
+		t.Errorf("got %v after remove", names)
+	}
+	if _, err := s.Stat("/pub/a.txt"); !errors.Is(err, fsp.ErrNotExist) {
+		t.Errorf("stat removed file: got %v", err)
+	}
+}
+
+func TestCacheVerifyModTime(t *testing.T) {
+	var srv, s = startServer(t)
+	var modTime = time.Now().Add(-time.Hour)
+	srv.WriteFile("/f.txt", []byte("old"), modTime)
+	s.SetCacheTTL(time.Minute)
+	if _, err := s.Stat("/f.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// same size, new mtime, the cached stat is stale
+	srv.WriteFile("/f.txt", []byte("new"), modTime.Add(time.Minute))
+	var verr *fsp.VerifyError
+	_, err := s.Download(context.Background(), "/f.txt", &bytes.Buffer{})
+	if !errors.As(err, &verr) || verr.Check != "mtime" {
+		t.Fatalf("got %v, want mtime verify error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/finove/fsp"
+)
+
+func discover() (servers []*fsp.ServerInfo, err error) {
+	return fsp.Discover(fsp.DiscoverOptions{
+		Interface: ifaceName,
+		Port:      int(remotePort),
+	})
+}
+
+// showServers print the servers answering discovery
+func showServers() (err error) {
+	var servers []*fsp.ServerInfo
+	servers, err = discover()
+	if err != nil {
+		return
+	}
+	for _, info := range servers {
+		var mac = "-"
+		if info.MAC != nil {
+			mac = info.MAC.String()
+		}
+		fmt.Printf("%-22s %-17s flags-0x%02x %s\n", info.Addr, mac, info.Flags, info.Version)
+	}
+	fmt.Printf("found %d servers\n", len(servers))
+	return
+}
+
+// findServer discover the server selected by --mac and --id
+func findServer() (addr *net.UDPAddr, err error) {
+	var servers []*fsp.ServerInfo
+	var mac net.HardwareAddr
+	var id *regexp.Regexp
+	if serverMAC != "" {
+		if mac, err = net.ParseMAC(serverMAC); err != nil {
+			return
+		}
+	}
+	if serverID != "" {
+		if id, err = regexp.Compile(serverID); err != nil {
+			return
+		}
+	}
+	servers, err = discover()
+	if err != nil {
+		return
+	}
+	for _, info := range servers {
+		if mac != nil && !bytes.Equal(mac, info.MAC) {
+			continue
+		}
+		if id != nil && !id.MatchString(info.Version) {
+			continue
+		}
+		return info.Addr, nil
+	}
+	err = fmt.Errorf("no fsp server match mac %q id %q in %d discovered", serverMAC, serverID, len(servers))
+	return
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/finove/fsp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	duDepth, treeLevel      int
+	duHuman, duSummarize    bool
+	treeSize, treeDate      bool
+	treeDirsOnly, treeHuman bool
+)
+
+var duCmd = &cobra.Command{
+	Use:     "du [dir]",
+	Short:   "summarize file count and bytes of remote directories recursively",
+	Example: "fspclient du /logs --depth 1 -H",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withSession(args, func(s *fsp.Session, dir string) error {
+			return runDu(os.Stdout, s, dir)
+		})
+	},
+}
+
+var treeCmd = &cobra.Command{
+	Use:     "tree [dir]",
+	Short:   "show remote directory hierarchy",
+	Example: "fspclient tree /pub --size --date -L 2",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withSession(args, func(s *fsp.Session, dir string) error {
+			return runTree(os.Stdout, s, dir)
+		})
+	},
+}
+
+func init() {
+	duCmd.Flags().IntVar(&duDepth, "depth", 0, "show directories up to this level below dir, 0 all")
+	duCmd.Flags().BoolVarP(&duHuman, "human", "H", false, "print sizes like 1.5M")
+	duCmd.Flags().BoolVar(&duSummarize, "summarize", false, "show only the total of dir")
+	treeCmd.Flags().IntVarP(&treeLevel, "level", "L", 0, "descend at most this level below dir, 0 all")
+	treeCmd.Flags().BoolVar(&treeSize, "size", false, "show file sizes")
+	treeCmd.Flags().BoolVarP(&treeHuman, "human", "H", false, "show sizes like 1.5M, implies --size")
+	treeCmd.Flags().BoolVar(&treeDate, "date", false, "show modification times")
+	treeCmd.Flags().BoolVar(&treeDirsOnly, "dirs-only", false, "show directories only")
+}
+
+// withSession open a session and run fn on the directory argument, "/" if
+// none is given
+func withSession(args []string, fn func(s *fsp.Session, dir string) error) {
+	var err error
+	var fspSession *fsp.Session
+	var dir = "/"
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if err = checkFormat(outputFormat); err != nil {
+		log.Printf("Failed, %v", err)
+		return
+	}
+	fspSession, err = openSession()
+	if err != nil {
+		log.Printf("Failed, %v", err)
+		return
+	}
+	defer fspSession.Close()
+	if err = fn(fspSession, dir); err != nil {
+		log.Printf("Failed, %s error %v", dir, err)
+	}
+}
+
+// humanSize format size with K, M, G or T unit
+func humanSize(size int64) string {
+	var value = float64(size)
+	var units = "BKMGT"
+	var i int
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(size, 10)
+	}
+	return fmt.Sprintf("%.1f%c", value, units[i])
+}
+
+// duRecord usage of one directory, including everything below it
+type duRecord struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Dirs  int    `json:"dirs"`
+	Size  int64  `json:"size"`
+	depth int
+}
+
+// runDu walk dir and print the usage of each directory after its children
+func runDu(w io.Writer, s *fsp.Session, dir string) (err error) {
+	var stack, done []*duRecord
+	var base = strings.Count(path.Clean("/"+dir), "/")
+	if path.Clean("/"+dir) == "/" {
+		base = 0
+	}
+	var leave = func() {
+		var top = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(stack) > 0 {
+			var parent = stack[len(stack)-1]
+			parent.Files += top.Files
+			parent.Dirs += top.Dirs + 1
+			parent.Size += top.Size
+		}
+		if len(stack) == 0 || (!duSummarize && (duDepth == 0 || top.depth <= duDepth)) {
+			done = append(done, top)
+		}
+	}
+	err = s.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil {
+				return err
+			}
+			log.Printf("Failed, list %s error %v", name, err)
+			return fs.SkipDir
+		}
+		for len(stack) > 0 && name != stack[len(stack)-1].Path &&
+			!strings.HasPrefix(name, strings.TrimSuffix(stack[len(stack)-1].Path, "/")+"/") {
+			leave()
+		}
+		if d.IsDir() {
+			var depth = strings.Count(path.Clean("/"+name), "/") - base
+			stack = append(stack, &duRecord{Path: name, depth: depth})
+			return nil
+		}
+		if len(stack) > 0 {
+			var top = stack[len(stack)-1]
+			var fi, _ = d.Info()
+			top.Files++
+			if fi != nil && fi.Mode().IsRegular() {
+				top.Size += fi.Size()
+			}
+		}
+		return nil
+	})
+	for len(stack) > 0 {
+		leave()
+	}
+	if err != nil {
+		return
+	}
+	return printDu(w, done, outputFormat)
+}
+
+func printDu(w io.Writer, records []*duRecord, format string) (err error) {
+	switch format {
+	case formatJSON:
+		var enc = json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(records)
+	case formatNDJSON:
+		var enc = json.NewEncoder(w)
+		for _, r := range records {
+			if err = enc.Encode(r); err != nil {
+				break
+			}
+		}
+	case formatCSV:
+		var cw = csv.NewWriter(w)
+		cw.Write([]string{"path", "files", "dirs", "size"})
+		for _, r := range records {
+			cw.Write([]string{r.Path, strconv.Itoa(r.Files), strconv.Itoa(r.Dirs), strconv.FormatInt(r.Size, 10)})
+		}
+		cw.Flush()
+		err = cw.Error()
+	default:
+		for _, r := range records {
+			var size = strconv.FormatInt(r.Size, 10)
+			if duHuman {
+				size = humanSize(r.Size)
+			}
+			fmt.Fprintf(w, "%-10s %8d files %6d dirs  %s\n", size, r.Files, r.Dirs, r.Path)
+		}
+	}
+	return
+}
+
+// treeNode one entry of the tree view
+type treeNode struct {
+	fi       os.FileInfo
+	children []*treeNode
+}
+
+// runTree walk dir and render it as an indented tree
+func runTree(w io.Writer, s *fsp.Session, dir string) (err error) {
+	var root = &treeNode{}
+	var nodes = map[string]*treeNode{}
+	var files, dirs int
+	var base = strings.Count(path.Clean("/"+dir), "/")
+	if path.Clean("/"+dir) == "/" {
+		base = 0
+	}
+	nodes[path.Clean(dir)] = root
+	err = s.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil {
+				return err
+			}
+			log.Printf("Failed, list %s error %v", name, err)
+			return fs.SkipDir
+		}
+		if name == dir {
+			return nil
+		}
+		if treeDirsOnly && !d.IsDir() {
+			return nil
+		}
+		var node = &treeNode{}
+		node.fi, _ = d.Info()
+		var parent = nodes[path.Dir(path.Clean(name))]
+		if parent != nil {
+			parent.children = append(parent.children, node)
+		}
+		if d.IsDir() {
+			dirs++
+			nodes[path.Clean(name)] = node
+			if treeLevel > 0 && strings.Count(path.Clean("/"+name), "/")-base >= treeLevel {
+				return fs.SkipDir
+			}
+		} else {
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, dir)
+	printTree(w, root, "")
+	fmt.Fprintf(w, "\n%d directories, %d files\n", dirs, files)
+	return
+}
+
+func printTree(w io.Writer, node *treeNode, indent string) {
+	for i, child := range node.children {
+		var branch, next = "├── ", "│   "
+		if i == len(node.children)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", indent, branch, treeInfo(child.fi), child.fi.Name())
+		printTree(w, child, indent+next)
+	}
+}
+
+// treeInfo size and date column of an entry, empty when not asked for
+func treeInfo(fi os.FileInfo) string {
+	var fields []string
+	if treeSize || treeHuman {
+		var size = strconv.FormatInt(fi.Size(), 10)
+		if treeHuman {
+			size = humanSize(fi.Size())
+		}
+		fields = append(fields, fmt.Sprintf("%10s", size))
+	}
+	if treeDate {
+		fields = append(fields, fi.ModTime().Format("2006-01-02 15:04"))
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(fields, " ") + "]  "
+}
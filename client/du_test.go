@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/finove/fsp/fsptest"
+)
+
+// startServer start a fsptest server holding a small tree and a session
+// connected to it
+func startServer(t *testing.T) (s *fsp.Session) {
+	t.Helper()
+	srv, err := fsptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = fsp.NewSession(srv.Addr, "")
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		srv.Close()
+	})
+	var modTime = time.Date(2024, 1, 2, 3, 4, 0, 0, time.Local)
+	srv.WriteFile("/pub/a.txt", make([]byte, 100), modTime)
+	srv.WriteFile("/pub/docs/b.txt", make([]byte, 2000), modTime)
+	srv.WriteFile("/pub/docs/old/c.txt", make([]byte, 3000), modTime)
+	return
+}
+
+func TestRunDu(t *testing.T) {
+	var s = startServer(t)
+	var tests = []struct {
+		depth     int
+		summarize bool
+		want      string
+	}{
+		{0, false, "/pub/docs/old 3000 1 0|/pub/docs 5000 2 1|/pub 5100 3 2"},
+		{1, false, "/pub/docs 5000 2 1|/pub 5100 3 2"},
+		{0, true, "/pub 5100 3 2"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		duDepth, duSummarize = tt.depth, tt.summarize
+		if err := runDu(&out, s, "/pub"); err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var f = strings.Fields(line)
+			lines = append(lines, strings.Join([]string{f[5], f[0], f[1], f[3]}, " "))
+		}
+		if got := strings.Join(lines, "|"); got != tt.want {
+			t.Errorf("depth %d summarize %v: got %s, want %s", tt.depth, tt.summarize, got, tt.want)
+		}
+	}
+	duDepth, duSummarize = 0, false
+}
+
+func TestRunTree(t *testing.T) {
+	var s = startServer(t)
+	var out strings.Builder
+	treeSize = true
+	defer func() { treeSize = false }()
+	if err := runTree(&out, s, "/pub"); err != nil {
+		t.Fatal(err)
+	}
+	var want = `/pub
+├── [       100]  a.txt
+└── [         0]  docs
+    ├── [      2000]  b.txt
+    └── [         0]  old
+        └── [      3000]  c.txt
+
+2 directories, 3 files
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	treeSize, treeLevel, treeDirsOnly = false, 1, true
+	defer func() { treeLevel, treeDirsOnly = 0, false }()
+	if err := runTree(&out, s, "/pub"); err != nil {
+		t.Fatal(err)
+	}
+	if want = "/pub\n└── docs\n\n1 directories, 0 files\n"; out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	for size, want := range map[int64]string{0: "0", 1023: "1023", 1536: "1.5K", 5 << 20: "5.0M", 3 << 30: "3.0G"} {
+		if got := humanSize(size); got != want {
+			t.Errorf("%d: got %s, want %s", size, got, want)
+		}
+	}
+}
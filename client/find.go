@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	findName, findRegex, findType string
+	findMinSize, findMaxSize      string
+	findNewer, findOlder          string
+	findMaxDepth                  int
+	findEmpty, findPrint0         bool
+	findDelete, findDownload      bool
+)
+
+var findCmd = &cobra.Command{
+	Use:   "find dir",
+	Short: "list remote files matching name, type, size and time predicates",
+	Example: `fspclient find /logs --name '*.gz' --older 30d --delete
+fspclient find / --type file --min-size 100m
+fspclient find /data --regex 'report-[0-9]+' --download -s ./reports`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts, err = findOptions()
+		if err != nil {
+			log.Printf("Failed, %v", err)
+			return
+		}
+		withSession(args, func(s *fsp.Session, dir string) error {
+			return runFind(s, dir, opts)
+		})
+	},
+}
+
+func init() {
+	findCmd.Flags().StringVar(&findName, "name", "", "base name matching the wildcard pattern")
+	findCmd.Flags().StringVar(&findRegex, "regex", "", "full path matching the regular expression")
+	findCmd.Flags().StringVar(&findType, "type", "", "entry type: file, dir or link (f, d, l)")
+	findCmd.Flags().StringVar(&findMinSize, "min-size", "", "size at least, k, m and g suffix allowed")
+	findCmd.Flags().StringVar(&findMaxSize, "max-size", "", "size at most, k, m and g suffix allowed")
+	findCmd.Flags().BoolVar(&findEmpty, "empty", false, "only files of zero size")
+	findCmd.Flags().StringVar(&findNewer, "newer", "", "modified after age like 90m, 24h, 7d or date 2006-01-02")
+	findCmd.Flags().StringVar(&findOlder, "older", "", "modified before age like 90m, 24h, 7d or date 2006-01-02")
+	findCmd.Flags().IntVar(&findMaxDepth, "maxdepth", 0, "levels below dir to descend, 0 no limit")
+	findCmd.Flags().BoolVar(&findPrint0, "print0", false, "print names separated by NUL instead of newline")
+	findCmd.Flags().BoolVar(&findDelete, "delete", false, "remove matching files and empty directories")
+	findCmd.Flags().BoolVar(&findDownload, "download", false, "download matching files below the --save directory")
+}
+
+// findOptions build the predicates from find flags
+func findOptions() (opts *fsp.FindOptions, err error) {
+	opts = &fsp.FindOptions{Name: findName, Empty: findEmpty, MaxDepth: findMaxDepth}
+	if findRegex != "" {
+		if opts.Regexp, err = regexp.Compile(findRegex); err != nil {
+			return
+		}
+	}
+	switch findType {
+	case "f", "file":
+		opts.Type = "file"
+	case "d", "dir":
+		opts.Type = "dir"
+	case "l", "link":
+		opts.Type = "link"
+	case "":
+	default:
+		err = fmt.Errorf("unknown type %q", findType)
+		return
+	}
+	if findMinSize != "" {
+		if opts.MinSize, err = parseSize(findMinSize); err != nil {
+			return
+		}
+	}
+	if findMaxSize != "" {
+		if opts.MaxSize, err = parseSize(findMaxSize); err != nil {
+			return
+		}
+	}
+	if findNewer != "" {
+		if opts.NewerThan, err = parseTime(findNewer); err != nil {
+			return
+		}
+	}
+	if findOlder != "" {
+		if opts.OlderThan, err = parseTime(findOlder); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseTime parse an age like 90m, 24h or 7d counted back from now, or a
+// date in 2006-01-02, 2006-01-02 15:04:05 or RFC3339 format
+func parseTime(value string) (t time.Time, err error) {
+	var d time.Duration
+	if strings.HasSuffix(value, "d") {
+		var days int
+		if days, err = strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err = time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+		if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("invalid time %q", value)
+	return
+}
+
+// runFind walk dir and apply the find actions to matching entries
+func runFind(s *fsp.Session, dir string, opts *fsp.FindOptions) (err error) {
+	var names []string
+	var infos []os.FileInfo
+	var separator = "\n"
+	var printNames = findPrint0 || (!findDelete && !findDownload)
+	if findPrint0 {
+		separator = "\x00"
+	}
+	err = s.Find(dir, opts, func(name string, fi os.FileInfo) error {
+		if printNames {
+			fmt.Print(name + separator)
+		}
+		names = append(names, name)
+		infos = append(infos, fi)
+		return nil
+	})
+	if findDownload {
+		var jobs []fsp.TransferJob
+		var saveDir = cmdSave
+		if saveDir == "" {
+			saveDir = "."
+		}
+		for i, name := range names {
+			if infos[i].IsDir() {
+				continue
+			}
+			var rel = strings.TrimPrefix(strings.TrimPrefix(name, strings.TrimSuffix(dir, "/")), "/")
+			jobs = append(jobs, fsp.TransferJob{Remote: name, Local: filepath.Join(saveDir, filepath.FromSlash(rel))})
+		}
+		if dlErr := runTransfers(s, jobs); dlErr != nil && err == nil {
+			err = dlErr
+		}
+	}
+	if findDelete {
+		if rmErr := deleteFound(s, names, infos); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+	return
+}
+
+// deleteFound remove found entries, deepest first so directories are empty
+// when their turn come
+func deleteFound(s *fsp.Session, names []string, infos []os.FileInfo) (err error) {
+	var failed int
+	for i := len(names) - 1; i >= 0; i-- {
+		if infos[i].IsDir() {
+			err = s.RemoveDir(names[i])
+		} else {
+			err = s.Remove(names[i])
+		}
+		if err != nil {
+			log.Printf("Failed, remove %s error %v", names[i], err)
+			failed++
+		}
+	}
+	err = nil
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d entries fail", failed, len(names))
+	}
+	return
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// output formats of listing and stat
+const (
+	formatText   = "text"
+	formatLong   = "long"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+// entryRecord machine readable form of one directory entry
+type entryRecord struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"mtime"`
+}
+
+// listRecord machine readable form of directory listing
+type listRecord struct {
+	Path       string        `json:"path"`
+	Protection uint8         `json:"protection"`
+	Files      int           `json:"files"`
+	Dirs       int           `json:"dirs"`
+	Links      int           `json:"links"`
+	Size       int64         `json:"size"`
+	Entries    []entryRecord `json:"entries"`
+}
+
+func newEntryRecord(fi os.FileInfo) entryRecord {
+	return entryRecord{
+		Name:    fi.Name(),
+		Type:    fsp.EntryType(fi),
+		Size:    fi.Size(),
+		ModTime: mtimeString(fi),
+	}
+}
+
+// mtimeString format modification time for json, ndjson and csv output
+func mtimeString(fi os.FileInfo) string {
+	return fi.ModTime().UTC().Format(time.RFC3339)
+}
+
+func checkFormat(format string) (err error) {
+	switch format {
+	case formatText, formatLong, formatJSON, formatNDJSON, formatCSV:
+	default:
+		err = fmt.Errorf("unknown output format %q, use text, long, json, ndjson or csv", format)
+	}
+	return
+}
+
+// protectionString render directory protection bits like ls mode string
+func protectionString(pro uint8) string {
+	var flags = []struct {
+		bit  uint8
+		char byte
+	}{
+		{fsp.FSPDirOwner, 'o'},
+		{fsp.FSPDirDel, 'd'},
+		{fsp.FSPDirAdd, 'a'},
+		{fsp.FSPDirMkDir, 'm'},
+		{fsp.FSPDirGet, 'p'},
+		{fsp.FSPDirReadme, 'r'},
+		{fsp.FSPDirList, 'l'},
+		{fsp.FSPDirRename, 'n'},
+	}
+	var bb = make([]byte, len(flags))
+	for i, f := range flags {
+		bb[i] = '-'
+		if pro&f.bit != 0 {
+			bb[i] = f.char
+		}
+	}
+	return string(bb)
+}
+
+// longString format entry like a line of ls -l
+func longString(fi os.FileInfo) string {
+	var kind = '-'
+	switch fsp.EntryType(fi) {
+	case "dir":
+		kind = 'd'
+	case "link":
+		kind = 'l'
+	}
+	return fmt.Sprintf("%c %12d %s %s", kind, fi.Size(), fi.ModTime().Format("Jan _2 2006 15:04"), fi.Name())
+}
+
+func writeCSV(w io.Writer, entries []os.FileInfo) (err error) {
+	var cw = csv.NewWriter(w)
+	cw.Write([]string{"name", "type", "size", "mtime"})
+	for _, fi := range entries {
+		cw.Write([]string{fi.Name(), fsp.EntryType(fi), strconv.FormatInt(fi.Size(), 10), mtimeString(fi)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeNDJSON(w io.Writer, entries []os.FileInfo) (err error) {
+	var enc = json.NewEncoder(w)
+	for _, fi := range entries {
+		if err = enc.Encode(newEntryRecord(fi)); err != nil {
+			break
+		}
+	}
+	return
+}
+
+// printList write directory listing in the given format
+func printList(w io.Writer, list *fsp.DirList, format string) (err error) {
+	switch format {
+	case formatJSON:
+		var rec = listRecord{
+			Path:       list.Path,
+			Protection: list.Protection,
+			Files:      list.Files,
+			Dirs:       list.Dirs,
+			Links:      list.Links,
+			Size:       list.Size,
+			Entries:    make([]entryRecord, 0, len(list.Entries)),
+		}
+		for _, fi := range list.Entries {
+			rec.Entries = append(rec.Entries, newEntryRecord(fi))
+		}
+		var enc = json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rec)
+	case formatNDJSON:
+		err = writeNDJSON(w, list.Entries)
+	case formatCSV:
+		err = writeCSV(w, list.Entries)
+	case formatLong:
+		fmt.Fprintf(w, "%s %s\n", protectionString(list.Protection), list.Path)
+		fmt.Fprintf(w, "total %d\n", list.Size)
+		for _, fi := range list.Entries {
+			fmt.Fprintln(w, longString(fi))
+		}
+	default:
+		var bb strings.Builder
+		bb.WriteString("[start]\n")
+		for _, fi := range list.Entries {
+			bb.WriteString(fsp.EntryString(fi))
+			bb.WriteByte('\n')
+		}
+		bb.WriteString("[end]\n")
+		fmt.Fprintf(&bb, "file-%d, link-%d, dir-%d\n", list.Files, list.Links, list.Dirs)
+		_, err = io.WriteString(w, bb.String())
+	}
+	return
+}
+
+// printStat write stat result in the given format
+func printStat(w io.Writer, fi os.FileInfo, format string) (err error) {
+	switch format {
+	case formatJSON, formatNDJSON:
+		err = json.NewEncoder(w).Encode(newEntryRecord(fi))
+	case formatCSV:
+		err = writeCSV(w, []os.FileInfo{fi})
+	case formatLong:
+		_, err = fmt.Fprintln(w, longString(fi))
+	default:
+		_, err = fmt.Fprintln(w, fsp.EntryString(fi))
+	}
+	return
+}
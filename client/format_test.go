@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// fakeInfo fixed directory entry
+type fakeInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (fi fakeInfo) Name() string      { return fi.name }
+func (fi fakeInfo) Size() int64       { return fi.size }
+func (fi fakeInfo) Mode() os.FileMode { return fi.mode }
+func (fi fakeInfo) ModTime() time.Time {
+	return time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+}
+func (fi fakeInfo) IsDir() bool      { return fi.mode.IsDir() }
+func (fi fakeInfo) Sys() interface{} { return nil }
+
+var testList = &fsp.DirList{
+	Path:       "/pub",
+	Protection: fsp.FSPDirOwner | fsp.FSPDirGet | fsp.FSPDirList,
+	Entries: []os.FileInfo{
+		fakeInfo{name: "a, b.txt", size: 100},
+		fakeInfo{name: "docs", mode: os.ModeDir},
+		fakeInfo{name: "latest", size: 8, mode: os.ModeSymlink},
+	},
+	Files: 1,
+	Dirs:  1,
+	Links: 1,
+	Size:  100,
+}
+
+func TestPrintList(t *testing.T) {
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{formatJSON, `{
+  "path": "/pub",
+  "protection": 81,
+  "files": 1,
+  "dirs": 1,
+  "links": 1,
+  "size": 100,
+  "entries": [
+    {
+      "name": "a, b.txt",
+      "type": "file",
+      "size": 100,
+      "mtime": "2024-01-02T02:04:05Z"
+    },
+    {
+      "name": "docs",
+      "type": "dir",
+      "size": 0,
+      "mtime": "2024-01-02T02:04:05Z"
+    },
+    {
+      "name": "latest",
+      "type": "link",
+      "size": 8,
+      "mtime": "2024-01-02T02:04:05Z"
+    }
+  ]
+}
+`},
+		{formatNDJSON, `{"name":"a, b.txt","type":"file","size":100,"mtime":"2024-01-02T02:04:05Z"}
+{"name":"docs","type":"dir","size":0,"mtime":"2024-01-02T02:04:05Z"}
+{"name":"latest","type":"link","size":8,"mtime":"2024-01-02T02:04:05Z"}
+`},
+		{formatCSV, `name,type,size,mtime
+"a, b.txt",file,100,2024-01-02T02:04:05Z
+docs,dir,0,2024-01-02T02:04:05Z
+latest,link,8,2024-01-02T02:04:05Z
+`},
+		{formatLong, `o---p-l- /pub
+total 100
+-          100 Jan  2 2024 03:04 a, b.txt
+d            0 Jan  2 2024 03:04 docs
+l            8 Jan  2 2024 03:04 latest
+`},
+		{formatText, `[start]
+file          100 2024/01/02 03:04:05 a, b.txt
+dir             0 2024/01/02 03:04:05 docs
+link            8 2024/01/02 03:04:05 latest
+[end]
+file-1, link-1, dir-1
+`},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := printList(&out, testList, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("format %s got\n%s\nwant\n%s", tt.format, out.String(), tt.want)
+		}
+	}
+}
+
+func TestPrintStat(t *testing.T) {
+	var fi = fakeInfo{name: "a.txt", size: 100}
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{formatJSON, `{"name":"a.txt","type":"file","size":100,"mtime":"2024-01-02T02:04:05Z"}` + "\n"},
+		{formatNDJSON, `{"name":"a.txt","type":"file","size":100,"mtime":"2024-01-02T02:04:05Z"}` + "\n"},
+		{formatCSV, "name,type,size,mtime\na.txt,file,100,2024-01-02T02:04:05Z\n"},
+		{formatLong, "-          100 Jan  2 2024 03:04 a.txt\n"},
+		{formatText, "file          100 2024/01/02 03:04:05 a.txt\n"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := printStat(&out, fi, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("format %s got %q, want %q", tt.format, out.String(), tt.want)
+		}
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	for _, format := range []string{formatText, formatLong, formatJSON, formatNDJSON, formatCSV} {
+		if err := checkFormat(format); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+	if err := checkFormat("xml"); err == nil {
+		t.Error("xml accepted")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/finove/fsp"
 	"github.com/spf13/cobra"
@@ -12,11 +15,21 @@ import (
 
 var (
 	serverIP                       string
-	localPort, remotePort          uint
+	localPort, remotePort, numJobs uint
 	serverPass, serverNewPass      string
 	cmdLS, cmdGet, cmdSave, cmdPut string
+	cmdStat, outputFormat          string
+	cmdRemove, cmdMove, cmdMoveTo  string
+	cmdCopy                        string
+	verifyChecks, streamAddr       string
+	rateLimit                      string
+	serverMAC, serverID, ifaceName string
+	discoverServers                bool
 	showServerVersion              bool
 	showClientVersion              bool
+	preserveTimes, skipUnchanged   bool
+	atomicUpload, serverLimit      bool
+	recursive, dryRun              bool
 )
 
 var rootCmd = &cobra.Command{
@@ -24,50 +37,106 @@ var rootCmd = &cobra.Command{
 	Version: "1.0.1",
 	Short:   "download file using fsp protocol",
 	Example: "some example usage",
+	Run:     run,
+}
+
+var getCmd = &cobra.Command{
+	Use:     "get remote-path",
+	Short:   "download a file, directory or wildcard, same as --get",
+	Example: "fspclient get /cfg.tar -o - | tar x",
+	Args:    cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		var err error
-		var fspSession *fsp.Session
-		var addr *net.UDPAddr
-		var conn *net.UDPConn
-		addr, conn, err = getFSPServerIP()
+		cmdGet = args[0]
+		run(cmd, args)
+	},
+}
+
+// run connect to the fsp server and execute the command selected by flags
+func run(cmd *cobra.Command, args []string) {
+	var err error
+	var fspSession *fsp.Session
+	if err = checkFormat(outputFormat); err != nil {
+		log.Printf("Failed, %v", err)
+		return
+	}
+	if discoverServers {
+		err = showServers()
 		if err != nil {
-			log.Printf("Failed, get fsp server ip %v", err)
-			return
+			log.Printf("Failed, discover servers %v", err)
+		}
+		return
+	}
+	fspSession, err = openSession()
+	if err != nil {
+		log.Printf("Failed, %v", err)
+		return
+	}
+	if showServerVersion {
+		fmt.Printf("fsp server version: %s\n", fspSession.Version())
+	} else if cmdLS != "" {
+		var list *fsp.DirList
+		list, err = fspSession.List(cmdLS)
+		if err == nil {
+			err = printList(os.Stdout, list, outputFormat)
 		}
-		fspSession, err = fsp.NewSessionWithConn(conn, addr.String(), serverPass)
 		if err != nil {
-			log.Printf("Failed, open fsp session %v", err)
-			return
+			log.Printf("Failed, read dir %v", err)
+		}
+	} else if cmdStat != "" {
+		var fi os.FileInfo
+		fi, err = fspSession.Stat(cmdStat)
+		if err == nil {
+			err = printStat(os.Stdout, fi, outputFormat)
+		}
+		if err != nil {
+			log.Printf("Failed, stat %s error %v", cmdStat, err)
+		}
+	} else if cmdGet != "" {
+		if cmdSave == "-" {
+			_, err = fspSession.Download(context.Background(), cmdGet, os.Stdout)
+		} else if len(cmdGet) > 0 && os.IsPathSeparator(cmdGet[len(cmdGet)-1]) && numJobs > 1 {
+			err = getDirectory(fspSession, cmdGet, cmdSave)
+		} else if len(cmdGet) > 0 && os.IsPathSeparator(cmdGet[len(cmdGet)-1]) {
+			err = fspSession.DownloadDirectory(cmdGet, cmdSave)
+		} else if fsp.HasMeta(cmdGet) {
+			err = getFiles(fspSession, cmdGet, cmdSave)
+		} else {
+			err = fspSession.DwonloadFile(cmdGet, cmdSave, 3)
+		}
+		if err != nil {
+			log.Printf("Failed, get file %s error %v", cmdGet, err)
 		}
-		if showServerVersion {
-			fmt.Printf("fsp server version: %s\n", fspSession.Version())
-		} else if cmdLS != "" {
-			err = fspSession.ShowDir(cmdLS)
-			if err != nil {
-				log.Printf("Failed, read dir %v", err)
-			}
-		} else if cmdGet != "" {
-			if len(cmdGet) > 0 && os.IsPathSeparator(cmdGet[len(cmdGet)-1]) {
-				err = fspSession.DownloadDirectory(cmdGet, cmdSave)
-			} else {
-				err = fspSession.DwonloadFile(cmdGet, cmdSave, 3)
-			}
-			if err != nil {
-				log.Printf("Failed, get file %s error %v", cmdGet, err)
-			}
-		} else if serverNewPass != "" {
-			err = fspSession.ChangePassword(serverNewPass)
-			if err != nil {
-				log.Printf("Failed, change password error %v", err)
-			}
-		} else if cmdPut != "" {
+	} else if cmdRemove != "" {
+		err = removeFiles(fspSession, cmdRemove)
+		if err != nil {
+			log.Printf("Failed, remove %s error %v", cmdRemove, err)
+		}
+	} else if cmdCopy != "" {
+		err = copyFiles(fspSession, cmdCopy, cmdMoveTo)
+		if err != nil {
+			log.Printf("Failed, copy %s error %v", cmdCopy, err)
+		}
+	} else if cmdMove != "" {
+		err = moveFiles(fspSession, cmdMove, cmdMoveTo)
+		if err != nil {
+			log.Printf("Failed, move %s error %v", cmdMove, err)
+		}
+	} else if serverNewPass != "" {
+		err = fspSession.ChangePassword(serverNewPass)
+		if err != nil {
+			log.Printf("Failed, change password error %v", err)
+		}
+	} else if cmdPut != "" {
+		if cmdPut == "-" {
+			err = putStdin(fspSession, cmdSave)
+		} else {
 			err = fspSession.UploadFile(cmdPut, cmdSave)
-			if err != nil {
-				log.Printf("Failed, upload file error %v", err)
-			}
 		}
-		fspSession.Close()
-	},
+		if err != nil {
+			log.Printf("Failed, upload file error %v", err)
+		}
+	}
+	fspSession.Close()
 }
 
 // Execute 执行命令行主程序
@@ -79,16 +148,38 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&serverIP, "ip", "", "fsp server ip:port")
-	rootCmd.Flags().UintVar(&localPort, "port", 0, "local port for used")
-	rootCmd.Flags().UintVar(&remotePort, "dport", 0, "fsp server port")
-	rootCmd.Flags().StringVarP(&serverPass, "password", "p", "", "fsp server password")
-	rootCmd.Flags().StringVar(&serverNewPass, "np", "", "change the password of FSP server")
-	rootCmd.Flags().StringVar(&cmdPut, "put", "", "upload file path")
-	rootCmd.Flags().StringVar(&cmdLS, "ls", "", "fsp command list files")
-	rootCmd.Flags().StringVarP(&cmdGet, "get", "g", "", "fsp command get files")
-	rootCmd.Flags().StringVarP(&cmdSave, "save", "s", "", "get file save path")
-	rootCmd.Flags().BoolVar(&showServerVersion, "server_version", false, "show server version")
+	rootCmd.AddCommand(getCmd, findCmd, duCmd, treeCmd, syncCmd, tailCmd)
+	rootCmd.PersistentFlags().StringVar(&serverIP, "ip", "", "fsp server host:port, [ipv6]:port or fsp://password@host:port URL")
+	rootCmd.PersistentFlags().StringVar(&streamAddr, "stream", "", "use framed stream instead of udp: tcp:host:port, unix:/path or serial device path")
+	rootCmd.PersistentFlags().UintVar(&localPort, "port", 0, "local port for used")
+	rootCmd.PersistentFlags().UintVar(&remotePort, "dport", 0, "fsp server port for --discover, --mac and --id, default 21")
+	rootCmd.PersistentFlags().BoolVar(&discoverServers, "discover", false, "list fsp servers answering a broadcast probe")
+	rootCmd.PersistentFlags().StringVar(&serverMAC, "mac", "", "use the discovered fsp server with this MAC address")
+	rootCmd.PersistentFlags().StringVar(&serverID, "id", "", "use the discovered fsp server whose version string matches this regexp")
+	rootCmd.PersistentFlags().StringVar(&ifaceName, "iface", "", "network interface for discovery, all if empty")
+	rootCmd.PersistentFlags().StringVarP(&serverPass, "password", "p", "", "fsp server password")
+	rootCmd.PersistentFlags().StringVar(&serverNewPass, "np", "", "change the password of FSP server")
+	rootCmd.PersistentFlags().StringVar(&cmdPut, "put", "", "upload file path, - read stdin and upload to the --save path")
+	rootCmd.PersistentFlags().StringVar(&cmdLS, "ls", "", "fsp command list files")
+	rootCmd.PersistentFlags().StringVar(&cmdStat, "stat", "", "fsp command show file information")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "format", formatText, "output format of ls and stat: text, long, json, ndjson or csv")
+	rootCmd.PersistentFlags().StringVarP(&cmdGet, "get", "g", "", "fsp command get files, wildcard like /logs/*.gz or /logs/**/*.gz allowed")
+	rootCmd.PersistentFlags().UintVarP(&numJobs, "jobs", "j", 1, "number of parallel sessions for directory and wildcard get")
+	rootCmd.PersistentFlags().StringVar(&cmdRemove, "rm", "", "fsp command remove files, wildcard allowed")
+	rootCmd.PersistentFlags().BoolVarP(&recursive, "recursive", "r", false, "rm remove directories and everything below them")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "only show what would be changed on the server")
+	rootCmd.PersistentFlags().StringVar(&cmdMove, "mv", "", "fsp command move files to the --to path, wildcard allowed")
+	rootCmd.PersistentFlags().StringVar(&cmdCopy, "cp", "", "fsp command copy files to the --to path, wildcard allowed")
+	rootCmd.PersistentFlags().StringVar(&cmdMoveTo, "to", "", "target path of mv and cp, cp also accept fsp://password@host:port/path of another server")
+	rootCmd.PersistentFlags().StringVarP(&cmdSave, "save", "s", "", "get file save path, - write file content to stdout")
+	rootCmd.PersistentFlags().StringVarP(&cmdSave, "output", "o", "", "same as --save")
+	rootCmd.PersistentFlags().StringVar(&verifyChecks, "verify", "size,mtime", "checks after download, comma list of size, mtime, sha256, md5 or none")
+	rootCmd.PersistentFlags().BoolVar(&preserveTimes, "preserve-times", true, "set modification time of downloaded files from server")
+	rootCmd.PersistentFlags().BoolVar(&skipUnchanged, "skip-unchanged", false, "skip download when local file has the same size and modification time")
+	rootCmd.PersistentFlags().StringVar(&rateLimit, "limit", "", "limit transfer speed in bytes per second, k and m suffix allowed, like 512k")
+	rootCmd.PersistentFlags().BoolVar(&serverLimit, "server-limit", false, "ask the server for its speed limit before transfers, costs 2 seconds when the server hide from version queries")
+	rootCmd.PersistentFlags().BoolVar(&atomicUpload, "atomic", false, "upload to a hidden temporary name and rename it into place when complete")
+	rootCmd.PersistentFlags().BoolVar(&showServerVersion, "server_version", false, "show server version")
 }
 
 func main() {
@@ -96,20 +187,144 @@ func main() {
 	return
 }
 
-func getFSPServerIP() (addr *net.UDPAddr, conn *net.UDPConn, err error) {
-	var localAddr *net.UDPAddr
-	if localPort > 0 {
-		localAddr, _ = net.ResolveUDPAddr("udp4", fmt.Sprintf(":%d", localPort))
+// openSession connect to the server selected by flags and apply the
+// session options
+func openSession() (fspSession *fsp.Session, err error) {
+	var addr *net.UDPAddr
+	var conn *net.UDPConn
+	if streamAddr != "" {
+		var tr fsp.Transport
+		tr, err = fsp.DialStream(streamAddr)
+		if err != nil {
+			err = fmt.Errorf("open stream %v", err)
+			return
+		}
+		fspSession, err = fsp.NewSessionWithTransport(tr, serverPass)
+	} else if localPort == 0 && serverIP != "" {
+		fspSession, err = fsp.NewSession(serverIP, serverPass)
+	} else {
+		addr, conn, err = getFSPServerIP()
+		if err != nil {
+			err = fmt.Errorf("get fsp server ip %v", err)
+			return
+		}
+		fspSession, err = fsp.NewSessionWithConn(conn, addr.String(), serverPass)
+	}
+	if err != nil {
+		err = fmt.Errorf("open fsp session %v", err)
+		return
+	}
+	if err = setVerify(fspSession, verifyChecks); err == nil {
+		err = setRateLimit(fspSession, rateLimit)
+	}
+	if err != nil {
+		fspSession.Close()
+		fspSession = nil
+		return
+	}
+	fspSession.SetAtomicUpload(atomicUpload)
+	fspSession.SetServerRateProbe(serverLimit)
+	fspSession.SetPreserveTimes(preserveTimes)
+	fspSession.SetSkipUnchanged(skipUnchanged)
+	return
+}
+
+// setVerify parse the --verify value and set the checks of session
+func setVerify(s *fsp.Session, checks string) (err error) {
+	var v fsp.Verify
+	for _, check := range strings.Split(checks, ",") {
+		switch strings.TrimSpace(check) {
+		case "size":
+			v |= fsp.VerifySize
+		case "mtime":
+			v |= fsp.VerifyModTime
+		case "sha256":
+			v |= fsp.VerifySHA256
+		case "md5":
+			v |= fsp.VerifyMD5
+		case "none", "":
+		default:
+			err = fmt.Errorf("unknown verify check %q", check)
+			return
+		}
+	}
+	s.SetVerify(v)
+	return
+}
+
+// setRateLimit parse the --limit value and set the rate limit of session
+func setRateLimit(s *fsp.Session, limit string) (err error) {
+	var rate int64
+	if strings.TrimSpace(limit) == "" {
+		return
+	}
+	rate, err = parseSize(limit)
+	if err != nil {
+		err = fmt.Errorf("invalid rate limit %q", limit)
+		return
 	}
+	s.SetRateLimit(rate)
+	return
+}
+
+// parseSize parse a byte count with optional k, m or g suffix
+func parseSize(value string) (size int64, err error) {
+	var unit int64 = 1
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		err = fmt.Errorf("empty size")
+		return
+	}
+	switch value[len(value)-1] {
+	case 'k':
+		unit = 1024
+	case 'm':
+		unit = 1024 * 1024
+	case 'g':
+		unit = 1024 * 1024 * 1024
+	}
+	if unit != 1 {
+		value = value[:len(value)-1]
+	}
+	size, err = strconv.ParseInt(value, 10, 64)
+	if err == nil && size < 0 {
+		err = fmt.Errorf("negative size")
+	}
+	size *= unit
+	return
+}
+
+// putStdin upload standard input to remotePath
+func putStdin(s *fsp.Session, remotePath string) (err error) {
+	if remotePath == "" || strings.HasSuffix(remotePath, "/") {
+		err = fmt.Errorf("upload from stdin need a remote file name in --save")
+		return
+	}
+	_, err = s.Upload(context.Background(), remotePath, os.Stdin, &fsp.UploadOptions{Atomic: atomicUpload})
+	return
+}
+
+func getFSPServerIP() (addr *net.UDPAddr, conn *net.UDPConn, err error) {
+	var addrs []*net.UDPAddr
+	var network = "udp4"
 	if serverIP != "" {
-		addr, err = net.ResolveUDPAddr("udp4", serverIP)
+		addrs, err = fsp.ResolveServer(serverIP)
+		if err != nil {
+			return nil, nil, err
+		}
+		addr = addrs[0]
+	} else if serverMAC != "" || serverID != "" {
+		addr, err = findServer()
 		if err != nil {
 			return nil, nil, err
 		}
-		conn, err = net.ListenUDP("udp4", localAddr)
 	} else {
-		err = fmt.Errorf("miss command line parameter, need -ip or -id or -mac value")
+		err = fmt.Errorf("miss command line parameter, need --ip, --mac or --id value")
 		return nil, nil, err
 	}
+	if addr.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err = net.ListenUDP(network, &net.UDPAddr{Port: int(localPort)})
 	return
 }
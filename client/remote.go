@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/finove/fsp"
+)
+
+// expandRemote expand pattern to the matching remote names, a name without
+// wildcard is returned as is
+func expandRemote(s *fsp.Session, pattern string) (names []string, err error) {
+	if !fsp.HasMeta(pattern) {
+		names = []string{pattern}
+		return
+	}
+	names, err = s.Glob(pattern)
+	if err == nil && len(names) == 0 {
+		err = fmt.Errorf("no remote file match %s", pattern)
+	}
+	return
+}
+
+// getFiles download every regular file matching pattern into saveDir, the
+// local names keep the path below the fixed leading part of pattern
+func getFiles(s *fsp.Session, pattern, saveDir string) (err error) {
+	var names, files []string
+	var failed int
+	names, err = expandRemote(s, pattern)
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		var fi os.FileInfo
+		if fi, err = s.Stat(name); err != nil {
+			log.Printf("Failed, stat %s error %v", name, err)
+			failed++
+			continue
+		}
+		if !fi.IsDir() {
+			files = append(files, name)
+		}
+	}
+	err = transferFiles(s, globRoot(pattern), files, saveDir)
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d of %d files fail", failed, len(names))
+	}
+	return
+}
+
+// getDirectory download the regular files of a remote directory with
+// parallel sessions, saveDir defaults to the remote path
+func getDirectory(s *fsp.Session, remoteDir, saveDir string) (err error) {
+	var list *fsp.DirList
+	var files []string
+	list, err = s.List(remoteDir)
+	if err != nil {
+		return
+	}
+	for _, fi := range list.Entries {
+		if fsp.EntryType(fi) == "file" {
+			files = append(files, path.Join(remoteDir, fi.Name()))
+		}
+	}
+	if saveDir == "" {
+		saveDir = strings.TrimPrefix(remoteDir, "/")
+	}
+	return transferFiles(s, remoteDir, files, saveDir)
+}
+
+// globRoot return the directory of pattern before the first element with
+// wildcard, for a plain name its directory
+func globRoot(pattern string) string {
+	var dir = path.Dir(pattern)
+	for fsp.HasMeta(dir) {
+		dir = path.Dir(dir)
+	}
+	return dir
+}
+
+// relPath return name relative to the root directory
+func relPath(root, name string) string {
+	if root != "." && root != "/" {
+		name = strings.TrimPrefix(name, root)
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// transferFiles download remote files below root into saveDir using --jobs
+// sessions
+func transferFiles(s *fsp.Session, root string, files []string, saveDir string) (err error) {
+	var jobs []fsp.TransferJob
+	for _, name := range files {
+		jobs = append(jobs, fsp.TransferJob{
+			Remote: name,
+			Local:  filepath.Join(saveDir, filepath.FromSlash(relPath(root, name))),
+		})
+	}
+	return runTransfers(s, jobs)
+}
+
+// runTransfers run jobs using --jobs sessions and report each file
+func runTransfers(s *fsp.Session, jobs []fsp.TransferJob) (err error) {
+	var manager = fsp.NewTransferManager(s, int(numJobs))
+	manager.Add(jobs...)
+	var report = manager.Run()
+	for _, res := range report.Results {
+		if res.Err != nil {
+			log.Printf("Failed, get file %s error %v", res.Job.Remote, res.Err)
+		} else {
+			fmt.Printf("get file %s done\n", res.Job.Remote)
+		}
+	}
+	if report.Failed > 0 {
+		err = fmt.Errorf("%d of %d files fail", report.Failed, len(report.Results))
+	}
+	return
+}
+
+// removeFiles delete every remote file matching pattern, with --recursive
+// directories are removed with their content
+func removeFiles(s *fsp.Session, pattern string) (err error) {
+	var names []string
+	var failed, total int
+	names, err = expandRemote(s, pattern)
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		if recursive {
+			var report *fsp.RemoveReport
+			report, err = s.RemoveTree(name, &fsp.RemoveOptions{DryRun: dryRun})
+			if err != nil {
+				log.Printf("Failed, remove %s error %v", name, err)
+				failed++
+				total++
+				continue
+			}
+			for _, res := range report.Results {
+				showRemoved(res.Path, res.Err)
+			}
+			failed += report.Failed
+			total += len(report.Results)
+			continue
+		}
+		total++
+		if !dryRun {
+			err = s.Remove(name)
+		}
+		showRemoved(name, err)
+		if err != nil {
+			failed++
+		}
+	}
+	err = nil
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d files fail", failed, total)
+	}
+	return
+}
+
+// showRemoved report the outcome of removing name
+func showRemoved(name string, err error) {
+	if err != nil {
+		log.Printf("Failed, remove %s error %v", name, err)
+	} else if dryRun {
+		fmt.Printf("would remove %s\n", name)
+	} else {
+		fmt.Printf("removed %s\n", name)
+	}
+}
+
+// moveFiles rename remote files matching pattern, when pattern has wildcard
+// or target end with "/" the files are moved into the target directory
+func moveFiles(s *fsp.Session, pattern, target string) (err error) {
+	var names []string
+	var failed int
+	if target == "" {
+		err = fmt.Errorf("miss move target, need --to value")
+		return
+	}
+	names, err = expandRemote(s, pattern)
+	if err != nil {
+		return
+	}
+	var intoDir = fsp.HasMeta(pattern) || strings.HasSuffix(target, "/")
+	for _, name := range names {
+		var newName = target
+		if intoDir {
+			newName = path.Join(target, path.Base(name))
+		}
+		if err = s.Rename(name, newName); err != nil {
+			log.Printf("Failed, move %s to %s error %v", name, newName, err)
+			failed++
+		}
+	}
+	err = nil
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d files fail", failed, len(names))
+	}
+	return
+}
+
+// copyFiles copy remote files matching pattern, target may be a fsp:// URL
+// of another server. When pattern has wildcard or target end with "/" the
+// files are copied into the target directory.
+func copyFiles(s *fsp.Session, pattern, target string) (err error) {
+	var names []string
+	var failed int
+	var dst = s
+	if target == "" {
+		err = fmt.Errorf("miss copy target, need --to value")
+		return
+	}
+	if u, e := fsp.ParseURL(target); e == nil {
+		dst, err = fsp.NewSession(u.Host, u.Password)
+		if err != nil {
+			return
+		}
+		defer dst.Close()
+		dst.SetAtomicUpload(atomicUpload)
+		target = u.Path
+	}
+	names, err = expandRemote(s, pattern)
+	if err != nil {
+		return
+	}
+	var intoDir = fsp.HasMeta(pattern) || strings.HasSuffix(target, "/")
+	for _, name := range names {
+		var newName = target
+		if intoDir {
+			newName = path.Join(target, path.Base(name))
+		}
+		if _, err = fsp.CopyBetween(s, name, dst, newName); err != nil {
+			log.Printf("Failed, copy %s to %s error %v", name, newName, err)
+			failed++
+		}
+	}
+	err = nil
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d files fail", failed, len(names))
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncDirection, syncSince string
+	syncDelete               bool
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync local-dir remote-dir",
+	Short: "compare a local and a remote tree and copy what differ",
+	Example: `fspclient sync ./bundle /cfg/bundle --dry-run
+fspclient sync ./backup /data --direction down --delete
+fspclient sync ./work /work --direction both --since 2024-05-01`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts, err = syncOptions()
+		if err != nil {
+			log.Printf("Failed, %v", err)
+			return
+		}
+		withSession(args[1:], func(s *fsp.Session, remoteDir string) error {
+			return runSync(s, args[0], remoteDir, opts)
+		})
+	},
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&syncDirection, "direction", "up", "up make remote like local, down make local like remote, both copy the newer side")
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "delete entries missing on the source side")
+	syncCmd.Flags().StringVar(&syncSince, "since", "", "time of the previous sync for --direction both, files changed on both sides after it are conflicts")
+}
+
+func syncOptions() (opts *fsp.SyncOptions, err error) {
+	opts = &fsp.SyncOptions{Delete: syncDelete}
+	switch syncDirection {
+	case "up":
+		opts.Direction = fsp.SyncUpload
+	case "down":
+		opts.Direction = fsp.SyncDownload
+	case "both":
+		opts.Direction = fsp.SyncBoth
+	default:
+		err = fmt.Errorf("unknown direction %q, use up, down or both", syncDirection)
+		return
+	}
+	if syncSince != "" {
+		var since time.Time
+		if since, err = parseTime(syncSince); err != nil {
+			return
+		}
+		opts.LastSync = since
+	}
+	return
+}
+
+// runSync plan the sync, print it and run it unless --dry-run is set
+func runSync(s *fsp.Session, localDir, remoteDir string, opts *fsp.SyncOptions) (err error) {
+	var plan *fsp.SyncPlan
+	var report *fsp.SyncReport
+	plan, err = s.PlanSync(localDir, remoteDir, opts)
+	if err != nil {
+		return
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Println("nothing to do")
+		return
+	}
+	plan.Print(os.Stdout)
+	if dryRun {
+		return
+	}
+	report = s.Sync(plan)
+	fmt.Printf("%d done, %d failed, %d conflicts\n", report.Done, report.Failed, report.Conflicts)
+	return report.Err()
+}
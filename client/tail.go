@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tailFollow   bool
+	tailLines    int
+	tailBytes    string
+	tailInterval time.Duration
+)
+
+var tailCmd = &cobra.Command{
+	Use:     "tail file",
+	Short:   "show the end of a remote file, with -f follow it as it grow",
+	Example: "fspclient tail -f /logs/device.log",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withSession(args, func(s *fsp.Session, name string) error {
+			return runTail(os.Stdout, s, name)
+		})
+	},
+}
+
+func init() {
+	tailCmd.Flags().BoolVarP(&tailFollow, "follow", "f", false, "keep reading data appended to the file")
+	tailCmd.Flags().IntVarP(&tailLines, "lines", "n", 10, "show the last lines of the file")
+	tailCmd.Flags().StringVarP(&tailBytes, "bytes", "c", "", "show the last bytes of the file instead of lines, k and m suffix allowed")
+	tailCmd.Flags().DurationVar(&tailInterval, "interval", time.Second, "poll interval of --follow")
+}
+
+// runTail print the end of name, then follow it until interrupted, a
+// missing file is an error unless following
+func runTail(w io.Writer, s *fsp.Session, name string) (err error) {
+	var t *fsp.Tail
+	var data []byte
+	var fromEnd int64
+	if tailBytes != "" {
+		if fromEnd, err = parseSize(tailBytes); err != nil {
+			return
+		}
+	} else {
+		// guess enough bytes for the lines, extra lines are cut below
+		fromEnd = int64(tailLines) * 256
+		if fromEnd < 4096 {
+			fromEnd = 4096
+		}
+	}
+	if !tailFollow {
+		if _, err = s.Stat(name); err != nil {
+			return
+		}
+	}
+	t, err = s.Tail(name, fromEnd)
+	if err != nil {
+		return
+	}
+	t.Interval = tailInterval
+	t.OnTruncate = func() {
+		log.Printf("%s: file truncated", name)
+	}
+	t.Follow = false
+	data, err = io.ReadAll(t)
+	if err != nil {
+		return
+	}
+	if tailBytes == "" {
+		data = lastLines(data, tailLines)
+	}
+	w.Write(data)
+	if !tailFollow {
+		return
+	}
+	var interrupt = make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		t.Close()
+	}()
+	t.Follow = true
+	_, err = io.Copy(w, t)
+	return
+}
+
+// lastLines return the last n lines of data
+func lastLines(data []byte, n int) []byte {
+	var end = len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := 0; i < n; i++ {
+		var pos = bytes.LastIndexByte(data[:end], '\n')
+		if pos < 0 {
+			return data
+		}
+		end = pos
+	}
+	return data[end+1:]
+}
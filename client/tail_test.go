@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/finove/fsp"
+)
+
+func TestRunTail(t *testing.T) {
+	var s = startServer(t)
+	var out strings.Builder
+	tailBytes = "10"
+	defer func() { tailBytes = "" }()
+	if err := runTail(&out, s, "/pub/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 10 {
+		t.Errorf("got %d bytes", out.Len())
+	}
+	if err := runTail(&out, s, "/pub/missing.log"); !errors.Is(err, fsp.ErrNotExist) {
+		t.Errorf("missing file got %v", err)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	var tests = []struct {
+		data string
+		n    int
+		want string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\n", 5, "a\nb\n"},
+		{"a\nb\n", 0, ""},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		if got := string(lastLines([]byte(tt.data), tt.n)); got != tt.want {
+			t.Errorf("lastLines(%q, %d) got %q, want %q", tt.data, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package fsp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// Copy duplicate the file src to dst on the server, the data is relayed by
+// the client without touching disk. dst get the modification time of src.
+func (s *Session) Copy(src, dst string) (err error) {
+	_, err = CopyBetween(s, src, s, dst)
+	return
+}
+
+// CopyBetween copy srcPath on the server of src to dstPath on the server of
+// dst, streaming CC_GET_FILE replies into CC_UP_LOAD requests. The source
+// modification time is sent with CC_INSTALL, the upload is atomic when dst
+// use SetAtomicUpload. n is the number of bytes copied.
+//
+// A session run one transfer at a time, so when src and dst are the same
+// the file is read by a forked session. Sessions that can not fork, on pipe
+// and stream transports, read the whole file into memory before writing it.
+func CopyBetween(src *Session, srcPath string, dst *Session, dstPath string) (n int64, err error) {
+	var fi os.FileInfo
+	var pr *io.PipeReader
+	var pw *io.PipeWriter
+	var reader = src
+	var readErr = make(chan error, 1)
+	var ctx = context.Background()
+	var opts = &UploadOptions{Atomic: dst.atomic}
+	fi, err = src.Stat(srcPath)
+	if err != nil {
+		return
+	}
+	if fi.IsDir() {
+		err = newOpError(srcPath + " is a directory")
+		return
+	}
+	opts.ModTime = fi.ModTime()
+	if src == dst {
+		if reader, err = src.fork(); err != nil {
+			var buff bytes.Buffer
+			if _, err = src.Download(ctx, srcPath, &buff); err != nil {
+				return
+			}
+			return dst.Upload(ctx, dstPath, &buff, opts)
+		}
+		reader.verify = src.verify
+		defer reader.Close()
+	}
+	pr, pw = io.Pipe()
+	go func() {
+		var _, err = reader.Download(ctx, srcPath, pw)
+		pw.CloseWithError(err)
+		readErr <- err
+	}()
+	n, err = dst.Upload(ctx, dstPath, pr, opts)
+	// stop the download when the upload failed first
+	pr.CloseWithError(io.ErrClosedPipe)
+	if e := <-readErr; e != nil && (err == nil || errors.Is(err, e)) {
+		// upload failed because of the read side, report the cause
+		err = e
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package fsp_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestCopy(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(7000)
+	var modTime = time.Date(2022, 2, 2, 2, 2, 2, 0, time.UTC)
+	srv.WriteFile("/src/f.bin", data, modTime)
+	srv.Mkdir("/dst")
+	// both transfers open a file and probe the server, see go test -race
+	s.SetServerRateProbe(true)
+	if err := s.Copy("/src/f.bin", "/dst/f.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.ReadFile("/dst/f.bin"); !bytes.Equal(got, data) {
+		t.Fatalf("copy has %d bytes, want %d", len(got), len(data))
+	}
+	if fi, err := s.Stat("/dst/f.bin"); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Errorf("copy mtime %v, %v, want %v", fi.ModTime(), err, modTime)
+	}
+
+	if err := s.Copy("/src/missing.bin", "/dst/missing.bin"); !errors.Is(err, fsp.ErrNotExist) {
+		t.Errorf("missing source: got %v", err)
+	}
+	if err := s.Copy("/src", "/dst/dir"); err == nil {
+		t.Error("no error copying a directory")
+	}
+	if srv.Exists("/dst/missing.bin") || srv.Exists("/dst/dir") {
+		t.Error("failed copy left a file")
+	}
+}
+
+func TestCopyPipeSession(t *testing.T) {
+	var srv, _ = startServer(t)
+	var client, server = fsp.NewPipe()
+	var data = testData(5000)
+	var modTime = time.Date(2022, 2, 2, 2, 2, 2, 0, time.UTC)
+	go srv.Serve(server)
+	defer server.Close()
+	s, err := fsp.NewSessionWithTransport(client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	srv.WriteFile("/src/f.bin", data, modTime)
+	if err = s.Copy("/src/f.bin", "/src/g.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.ReadFile("/src/g.bin"); !bytes.Equal(got, data) {
+		t.Fatalf("copy has %d bytes, want %d", len(got), len(data))
+	}
+	if fi, err := s.Stat("/src/g.bin"); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Errorf("copy mtime %v, %v, want %v", fi.ModTime(), err, modTime)
+	}
+}
+
+func TestCopyBetween(t *testing.T) {
+	var srcSrv, src = startServer(t)
+	var dstSrv, dst = startServer(t)
+	var data = testData(7000)
+	srcSrv.WriteFile("/f.bin", data, time.Now())
+	dst.SetAtomicUpload(true)
+	n, err := fsp.CopyBetween(src, "/f.bin", dst, "/copy.bin")
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("copied %d bytes, %v", n, err)
+	}
+	if got, _ := dstSrv.ReadFile("/copy.bin"); !bytes.Equal(got, data) {
+		t.Fatalf("copy has %d bytes, want %d", len(got), len(data))
+	}
+	if names := remoteNames(t, dst, "/"); len(names) != 1 {
+		t.Errorf("got %v on destination, temporary file left", names)
+	}
+}
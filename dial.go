@@ -0,0 +1,237 @@
+package fsp
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultPort is the standard FSP port
+const DefaultPort = 21
+
+// delays of Happy Eyeballs style connecting
+const (
+	probeStagger = 250 * time.Millisecond // start of next address family
+	probeTimeout = 2 * time.Second        // give up probing, use first address
+)
+
+// URL is a parsed fsp://password@hostname:port/directory/filename.ext
+type URL struct {
+	Password string // empty when no password in URL
+	Host     string // host:port, port defaults to 21
+	Path     string // directory or file path, "/" if omitted
+}
+
+// ParseURL parse a fsp:// URL, IPv6 hosts are written in brackets like
+// fsp://[::1]:2121/pub
+func ParseURL(rawurl string) (u *URL, err error) {
+	var parsed *url.URL
+	parsed, err = url.Parse(rawurl)
+	if err != nil {
+		return
+	}
+	if parsed.Scheme != "fsp" || parsed.Host == "" {
+		err = newOpError("not a fsp URL: " + rawurl)
+		return
+	}
+	u = &URL{Path: parsed.Path}
+	if parsed.User != nil {
+		u.Password = parsed.User.Username()
+	}
+	var port = parsed.Port()
+	if port == "" {
+		port = strconv.Itoa(DefaultPort)
+	}
+	u.Host = net.JoinHostPort(parsed.Hostname(), port)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return
+}
+
+// splitServerAddress accept "host", "host:port", "[ipv6]:port", bare IPv6
+// address or fsp:// URL
+func splitServerAddress(address string) (host, port, password string, err error) {
+	if u, e := ParseURL(address); e == nil {
+		address, password = u.Host, u.Password
+	}
+	host, port, err = net.SplitHostPort(address)
+	if err != nil {
+		// no port, address is a host name or a bare IP
+		host, port, err = address, strconv.Itoa(DefaultPort), nil
+		if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+			host = host[1 : len(host)-1]
+		}
+	}
+	if host == "" {
+		err = newOpError("invalid server address " + address)
+	}
+	return
+}
+
+// ResolveServer return the UDP addresses of a server address in any form
+// accepted by NewSession
+func ResolveServer(serverAddress string) (addrs []*net.UDPAddr, err error) {
+	var host, port string
+	host, port, _, err = splitServerAddress(serverAddress)
+	if err != nil {
+		return
+	}
+	return resolveServer(host, port)
+}
+
+// udpNetwork return "udp4" or "udp6" for ip
+func udpNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
+// resolveServer return the addresses of host, IPv6 and IPv4 interleaved
+// starting with the family of the first address returned by the resolver
+func resolveServer(host, port string) (addrs []*net.UDPAddr, err error) {
+	var ips []net.IPAddr
+	var portNum int
+	var v4, v6 []*net.UDPAddr
+	portNum, err = net.LookupPort("udp", port)
+	if err != nil {
+		return
+	}
+	if portNum == 0 {
+		err = newOpError("invalid server port")
+		return
+	}
+	ips, err = net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return
+	}
+	for _, ip := range ips {
+		var addr = &net.UDPAddr{IP: ip.IP, Port: portNum, Zone: ip.Zone}
+		if ip.IP.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+	var first, second = v6, v4
+	if len(ips) > 0 && ips[0].IP.To4() != nil {
+		first, second = v4, v6
+	}
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			addrs = append(addrs, first[i])
+		}
+		if i < len(second) {
+			addrs = append(addrs, second[i])
+		}
+	}
+	if len(addrs) == 0 {
+		err = newKindError(ErrNotExist, "no address for "+host)
+	}
+	return
+}
+
+// probeResult answer of one address to CC_VERSION
+type probeResult struct {
+	conn *net.UDPConn
+	addr *net.UDPAddr
+	key  uint16
+	err  error
+}
+
+// probe send CC_VERSION to addr and wait for any valid reply
+func probe(ctx context.Context, addr *net.UDPAddr, key uint16) (res probeResult) {
+	var buff = make([]byte, FSPMaxPacket)
+	var req []byte
+	var p *Packet
+	res.addr = addr
+	res.conn, res.err = net.ListenUDP(udpNetwork(addr.IP), nil)
+	if res.err != nil {
+		return
+	}
+	req, _ = EncodeRequest(&Packet{Cmd: FSPCommandVersion, Key: key})
+	var deadline, _ = ctx.Deadline()
+	for ctx.Err() == nil {
+		if _, res.err = res.conn.WriteToUDP(req, addr); res.err != nil {
+			break
+		}
+		var wait = time.Now().Add(500 * time.Millisecond)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		res.conn.SetReadDeadline(wait)
+		for {
+			n, err := res.conn.Read(buff)
+			if err != nil {
+				break
+			}
+			if p, err = DecodeReply(buff[:n]); err == nil {
+				res.key = p.Key
+				return
+			}
+		}
+		// an ICMP error ends the read early, do not resend before wait
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Until(wait)):
+		}
+	}
+	res.conn.Close()
+	res.conn = nil
+	if res.err == nil {
+		res.err = newKindError(ErrTimeout, "no reply from "+addr.String())
+	}
+	return
+}
+
+// dialServer open a UDP socket to the best address of host. When host has
+// more than one address they are probed Happy Eyeballs style: each address
+// gets a CC_VERSION a little after the previous one and the first to
+// answer wins. If none answers, the first address is used.
+func dialServer(host, port string, keys KeyStore) (conn *net.UDPConn, addr *net.UDPAddr, err error) {
+	var addrs []*net.UDPAddr
+	addrs, err = resolveServer(host, port)
+	if err != nil {
+		return
+	}
+	if len(addrs) > 1 {
+		var key = keys.Acquire()
+		keys.Release(key)
+		var ctx, cancel = context.WithTimeout(context.Background(), probeTimeout)
+		var results = make(chan probeResult, len(addrs))
+		for i, a := range addrs {
+			go func(i int, a *net.UDPAddr) {
+				select {
+				case <-time.After(time.Duration(i) * probeStagger):
+					results <- probe(ctx, a, key)
+				case <-ctx.Done():
+					results <- probeResult{err: ctx.Err()}
+				}
+			}(i, a)
+		}
+		for range addrs {
+			var res = <-results
+			if res.err != nil {
+				continue
+			}
+			if conn != nil {
+				res.conn.Close()
+				continue
+			}
+			conn, addr = res.conn, res.addr
+			keys.Acquire()
+			keys.Release(res.key)
+			cancel()
+		}
+		cancel()
+		if conn != nil {
+			return
+		}
+	}
+	addr = addrs[0]
+	conn, err = net.ListenUDP(udpNetwork(addr.IP), nil)
+	return
+}
@@ -0,0 +1,69 @@
+package fsp_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestParseURL(t *testing.T) {
+	var tests = []struct {
+		raw  string
+		want fsp.URL
+	}{
+		{"fsp://host", fsp.URL{Host: "host:21", Path: "/"}},
+		{"fsp://secret@host:2121/pub/a.txt", fsp.URL{Password: "secret", Host: "host:2121", Path: "/pub/a.txt"}},
+		{"fsp://[::1]:2121/pub", fsp.URL{Host: "[::1]:2121", Path: "/pub"}},
+		{"fsp://[fe80::1]", fsp.URL{Host: "[fe80::1]:21", Path: "/"}},
+	}
+	for _, tt := range tests {
+		u, err := fsp.ParseURL(tt.raw)
+		if err != nil || *u != tt.want {
+			t.Errorf("%s: got %+v, %v", tt.raw, u, err)
+		}
+	}
+	for _, raw := range []string{"http://host/", "fsp:///path", "host:21"} {
+		if _, err := fsp.ParseURL(raw); err == nil {
+			t.Errorf("%s: no error", raw)
+		}
+	}
+}
+
+func TestResolveServer(t *testing.T) {
+	var tests = []struct {
+		address string
+		want    string
+	}{
+		{"127.0.0.1", "127.0.0.1:21"},
+		{"127.0.0.1:2121", "127.0.0.1:2121"},
+		{"::1", "[::1]:21"},
+		{"[::1]", "[::1]:21"},
+		{"[::1]:2121", "[::1]:2121"},
+		{"fsp://pw@127.0.0.1:2121/pub", "127.0.0.1:2121"},
+	}
+	for _, tt := range tests {
+		addrs, err := fsp.ResolveServer(tt.address)
+		if err != nil || len(addrs) == 0 || addrs[0].String() != tt.want {
+			t.Errorf("%s: got %v, %v, want %s", tt.address, addrs, err, tt.want)
+		}
+	}
+}
+
+func TestSessionURLPassword(t *testing.T) {
+	var srv, _ = startServer(t)
+	var _, port, _ = net.SplitHostPort(srv.Addr)
+	srv.WriteFile("/pub/a.txt", []byte("a"), time.Now())
+	srv.SetPassword("secret")
+	// localhost may resolve to ::1 first, the server only answers on IPv4
+	s, err := fsp.NewSession("fsp://secret@localhost:"+port+"/pub", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	fi, err := s.Stat("/pub/a.txt")
+	if err != nil || fi.Size() != 1 {
+		t.Fatalf("stat with URL password: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package fsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+)
+
+// server flags of CC_VERSION extra data
+const (
+	FSPServerLogging   = 0x01 // server does logging
+	FSPServerReadOnly  = 0x02 // server is read only
+	FSPServerRevLookup = 0x04 // reverse lookup required
+	FSPServerPrivate   = 0x08 // server is in private mode
+	FSPServerThruput   = 0x10 // thruput control, MaxThruput is set
+	FSPServerXtraData  = 0x20 // server accept XTRA DATA on input
+)
+
+// ServerInfo server version string and setup from CC_VERSION
+type ServerInfo struct {
+	Addr       *net.UDPAddr     // server address
+	MAC        net.HardwareAddr // hardware address from ARP table, nil if unknown
+	Version    string           // server version string
+	Flags      uint8            // FSPServer* bits
+	MaxThruput uint32           // max thruput allowed in bytes/sec, 0 if no limit
+	MaxPayload uint16           // max payload size if > 1024, otherwise preferred size
+}
+
+// ReadOnly report whether the server is read only
+func (info *ServerInfo) ReadOnly() bool {
+	return info.Flags&FSPServerReadOnly != 0
+}
+
+// parseServerInfo decode CC_VERSION reply
+/*
+	reply
+	file position:  size of optional extra version data
+	data:           ASCIIZ Server version string
+	xtra data:      optional extra version data
+			byte - FLAGS
+			if bit 4 is set thruput info follows
+			long - max_thruput allowed (in bytes/sec)
+			word - max. payload size supported by server
+*/
+func parseServerInfo(data, xtra []byte) (info *ServerInfo) {
+	info = &ServerInfo{}
+	if n := bytes.IndexByte(data, 0); n >= 0 {
+		data = data[:n]
+	}
+	info.Version = string(data)
+	if len(xtra) >= 1 {
+		info.Flags = xtra[0]
+	}
+	if info.Flags&FSPServerThruput != 0 && len(xtra) >= 5 {
+		info.MaxThruput = binary.BigEndian.Uint32(xtra[1:])
+		if len(xtra) >= 7 {
+			info.MaxPayload = binary.BigEndian.Uint16(xtra[5:])
+		}
+	}
+	return
+}
+
+// ServerInfo get server version string and setup, the thruput limit of
+// the reply is applied to the session
+func (s *Session) ServerInfo() (info *ServerInfo, err error) {
+	return s.serverInfo(0)
+}
+
+// serverInfo send CC_VERSION giving up after limit, 0 use the session timeout
+func (s *Session) serverInfo(limit time.Duration) (info *ServerInfo, err error) {
+	var pkt fspPacket
+	var resp fspPacket
+	pkt.cmd = FSPCommandVersion
+	pkt.xlen = 0
+	pkt.pos = 0
+	resp, err = s.transactionWithin(&pkt, limit)
+	if err != nil {
+		return
+	}
+	var xtra = resp.buf[resp.len:]
+	if int(resp.pos) < len(xtra) {
+		xtra = xtra[:resp.pos]
+	}
+	info = parseServerInfo(resp.buf[:resp.len], xtra)
+	info.Addr = s.serverAddr
+	s.rateChecked = true
+	s.serverRate = int64(info.MaxThruput)
+	s.applyRate()
+	return
+}
+
+// DiscoverOptions control Discover
+type DiscoverOptions struct {
+	Interface string        // probe only the subnets of this interface, all if empty
+	Target    string        // probe this address instead, like a multicast group or subnet broadcast
+	Port      int           // server port, DefaultPort if 0
+	Timeout   time.Duration // time to collect replies, 2 seconds if 0
+}
+
+// Discover find FSP servers on the local IPv4 subnets by broadcasting a
+// CC_VERSION probe and collecting the replies. Servers that do not answer
+// CC_VERSION can not be found this way.
+func Discover(opts DiscoverOptions) (servers []*ServerInfo, err error) {
+	var conn *net.UDPConn
+	var targets []*net.UDPAddr
+	var keys *fileKeyStore
+	var req []byte
+	var seen = make(map[string]bool)
+	if opts.Port == 0 {
+		opts.Port = DefaultPort
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	targets, err = discoverTargets(opts)
+	if err != nil {
+		return
+	}
+	conn, err = net.ListenUDP("udp4", nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	keys, _ = newFileKeyStore()
+	var key = keys.Acquire()
+	keys.Release(key)
+	req, _ = EncodeRequest(&Packet{Cmd: FSPCommandVersion, Key: key})
+	for _, target := range targets {
+		conn.WriteToUDP(req, target)
+	}
+	var buff = make([]byte, FSPMaxPacket)
+	conn.SetReadDeadline(time.Now().Add(opts.Timeout))
+	for {
+		n, from, e := conn.ReadFromUDP(buff)
+		if e != nil {
+			break
+		}
+		p, e := DecodeReply(buff[:n])
+		if e != nil || p.Cmd != FSPCommandVersion || seen[from.String()] {
+			continue
+		}
+		seen[from.String()] = true
+		var info = parseServerInfo(p.Data, p.Xtra)
+		info.Addr = from
+		info.MAC, _ = LookupMAC(from.IP)
+		servers = append(servers, info)
+	}
+	return
+}
+
+// discoverTargets broadcast addresses of the selected interfaces
+func discoverTargets(opts DiscoverOptions) (targets []*net.UDPAddr, err error) {
+	var ifaces []net.Interface
+	if opts.Target != "" {
+		var addr *net.UDPAddr
+		addr, err = net.ResolveUDPAddr("udp4", net.JoinHostPort(opts.Target, strconv.Itoa(opts.Port)))
+		if err == nil {
+			targets = append(targets, addr)
+		}
+		return
+	}
+	if opts.Interface != "" {
+		var iface *net.Interface
+		iface, err = net.InterfaceByName(opts.Interface)
+		if err != nil {
+			return
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		ifaces, err = net.Interfaces()
+		if err != nil {
+			return
+		}
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, e := iface.Addrs()
+		if e != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			var ip = ipnet.IP.To4()
+			var bcast = make(net.IP, 4)
+			for i := range bcast {
+				bcast[i] = ip[i] | ^ipnet.Mask[len(ipnet.Mask)-4+i]
+			}
+			targets = append(targets, &net.UDPAddr{IP: bcast, Port: opts.Port})
+		}
+	}
+	if len(targets) == 0 {
+		targets = append(targets, &net.UDPAddr{IP: net.IPv4bcast, Port: opts.Port})
+	}
+	return
+}
@@ -0,0 +1,36 @@
+package fsp_test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestServerInfo(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.SetVersion("fsptest 1.0", fsp.FSPServerReadOnly|fsp.FSPServerThruput, 50000, 1400)
+	info, err := s.ServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "fsptest 1.0" || !info.ReadOnly() || info.MaxThruput != 50000 || info.MaxPayload != 1400 {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	var srv, _ = startServer(t)
+	var host, port, _ = net.SplitHostPort(srv.Addr)
+	var portNum, _ = strconv.Atoi(port)
+	srv.SetVersion("found me", 0, 0, 0)
+	servers, err := fsp.Discover(fsp.DiscoverOptions{Target: host, Port: portNum, Timeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Version != "found me" || servers[0].Addr.String() != srv.Addr {
+		t.Fatalf("got %d servers %+v", len(servers), servers)
+	}
+}
@@ -0,0 +1,61 @@
+package fsp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Download stream remotePath to w, the verify checks of session are done
+// after the last byte is written. n is the number of bytes written to w.
+func (s *Session) Download(ctx context.Context, remotePath string, w io.Writer) (n int64, err error) {
+	var before os.FileInfo
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s.verify != 0 {
+		before, err = s.Stat(remotePath)
+		if err != nil {
+			return
+		}
+	}
+	n, err = s.download(ctx, remotePath, w, before)
+	return
+}
+
+// download copy remotePath to w and verify it against before, no check is
+// done when before is nil
+func (s *Session) download(ctx context.Context, remotePath string, w io.Writer, before os.FileInfo) (written int64, err error) {
+	var fspFile *File
+	var sums downloadSums
+	var buff []byte
+	var done int
+	fspFile, err = s.openFile(remotePath, "rb")
+	if err != nil || fspFile == nil {
+		s.verbose(1, "open fsp file fail, err %v", err)
+		return
+	}
+	defer fspFile.Close()
+	sums = s.newDownloadSums()
+	w = sums.writer(w)
+	buff = make([]byte, FSPSpace)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		done, err = fspFile.Read(buff, 1, 1024)
+		if err != nil || done <= 0 {
+			break
+		}
+		if _, err = w.Write(buff[:done]); err != nil {
+			err = newOpError(fmt.Sprintf("write %s fail, %v", remotePath, err))
+			break
+		}
+		written += int64(done)
+	}
+	if err == nil {
+		err = s.verifyDownload(remotePath, before, written, sums)
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package fsp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// limitWriter accept limit bytes, then fail
+type limitWriter struct {
+	limit int
+}
+
+func (w *limitWriter) Write(p []byte) (n int, err error) {
+	if len(p) > w.limit {
+		return 0, errors.New("writer full")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestDownload(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(10000)
+	srv.WriteFile("/down.bin", data, time.Now())
+	for _, v := range []fsp.Verify{0, fsp.VerifyDefault} {
+		var buff bytes.Buffer
+		s.SetVerify(v)
+		n, err := s.Download(context.Background(), "/down.bin", &buff)
+		if err != nil || n != int64(len(data)) || !bytes.Equal(buff.Bytes(), data) {
+			t.Errorf("verify %d: got %d bytes, %v", v, n, err)
+		}
+	}
+	srv.WriteFile("/empty.bin", nil, time.Now())
+	if n, err := s.Download(context.Background(), "/empty.bin", &bytes.Buffer{}); err != nil || n != 0 {
+		t.Errorf("empty file: got %d bytes, %v", n, err)
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.WriteFile("/down.bin", testData(10000), time.Now())
+	for _, v := range []fsp.Verify{0, fsp.VerifyDefault} {
+		s.SetVerify(v)
+		if _, err := s.Download(context.Background(), "/missing.bin", &bytes.Buffer{}); !errors.Is(err, fsp.ErrNotExist) {
+			t.Errorf("verify %d, missing file: got %v", v, err)
+		}
+	}
+	n, err := s.Download(context.Background(), "/down.bin", &limitWriter{limit: 3000})
+	if err == nil || n > 3000 {
+		t.Errorf("failing writer: got %d bytes, %v", n, err)
+	}
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = s.Download(ctx, "/down.bin", &bytes.Buffer{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got %v", err)
+	}
+}
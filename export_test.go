@@ -0,0 +1,57 @@
+package fsp
+
+// Hooks for the tests of package fsp_test. They can not be in package fsp
+// because they use fsptest, which imports fsp.
+
+// Transaction send p with s.transaction and return the reply
+func Transaction(s *Session, p *Packet) (reply *Packet, err error) {
+	var resp fspPacket
+	var out = fspPacket{
+		cmd:  p.Cmd,
+		pos:  p.Pos,
+		len:  uint16(len(p.Data)),
+		xlen: uint16(len(p.Xtra)),
+		buf:  append(append([]byte{}, p.Data...), p.Xtra...),
+	}
+	resp, err = s.transaction(&out)
+	if err != nil {
+		return
+	}
+	reply = &Packet{Cmd: resp.cmd, Key: resp.key, Seq: resp.seq, Pos: resp.pos,
+		Data: resp.buf[:resp.len], Xtra: resp.buf[resp.len:]}
+	return
+}
+
+// DirEntries read dirName with getDir, return the entry names and the
+// listing block size
+func DirEntries(s *Session, dirName string) (names []string, blockSize int, err error) {
+	var di *dir
+	var entrys []*dirEntry
+	di, err = s.getDir(dirName)
+	if err != nil {
+		return
+	}
+	entrys, err = di.ListEntrys()
+	for _, entry := range entrys {
+		names = append(names, entry.Name)
+	}
+	blockSize = int(di.blockSize)
+	return
+}
+
+// OpenFile open remote file, mode is "rb" or "wb"
+func OpenFile(s *Session, name, mode string) (*File, error) {
+	return s.openFile(name, mode)
+}
+
+// SeekTo move the position of the next read or write
+func (f *File) SeekTo(pos int64) error {
+	f.pos = pos
+	f.eof = false
+	return f.seek(0)
+}
+
+// Abort cancel the upload
+func (f *File) Abort() error {
+	return f.abort()
+}
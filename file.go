@@ -1,9 +1,9 @@
 package fsp
 
 import (
+	"bytes"
 	"encoding/binary"
-	"fmt"
-	"strings"
+	"os"
 	"time"
 )
 
@@ -22,27 +22,32 @@ type dirEntry struct {
 	NameLen    uint16
 	Type       uint8
 	RecordLen  uint16
-	Size       uint
+	Size       int64
 	LastModify int64
 }
 
 // Show display entry
 func (entry *dirEntry) Show() (resp string) {
-	var bb strings.Builder
-	var modify time.Time
+	switch entry.Type {
+	case fspEntryTypeDir, fspEntryTypeFile, fspEntryTypeLink:
+		resp = EntryString(entry.fileInfo())
+	}
+	return
+}
+
+// fileInfo convert entry to os.FileInfo
+func (entry *dirEntry) fileInfo() (st fileStat) {
+	st.name = entry.Name
+	st.modTime = time.Unix(entry.LastModify, 0)
+	st.size = entry.Size
 	switch entry.Type {
 	case fspEntryTypeDir:
-		bb.WriteString("dir    ")
-	case fspEntryTypeFile:
-		bb.WriteString("file   ")
+		st.mode = os.ModeDir | 0755
 	case fspEntryTypeLink:
-		bb.WriteString("link   ")
+		st.mode = os.ModeSymlink | 0777
 	default:
-		return
+		st.mode = 0644
 	}
-	modify = time.Unix(entry.LastModify, 0)
-	bb.WriteString(fmt.Sprintf("%10d %s %s", entry.Size, modify.Format("2006/01/02 15:04:05"), entry.Name))
-	resp = bb.String()
 	return
 }
 
@@ -56,9 +61,8 @@ type dir struct {
 	data      []byte
 }
 
-// ListEntrys get all dir entrys
-func (d *dir) ListEntrys() (entrys []*dirEntry) {
-	var err error
+// ListEntrys get all dir entrys, err is set when the listing is malformed
+func (d *dir) ListEntrys() (entrys []*dirEntry, err error) {
 	var entry *dirEntry
 	for {
 		if d.dirPos < 0 || d.dirPos%4 != 0 {
@@ -88,41 +92,50 @@ struct RDIRENT {
 func (d *dir) ReadNative() (entry *dirEntry, err error) {
 	var fType byte
 	var nameLen int
+	var end = int(d.dataSize)
 	if d.dirPos < 0 || d.dirPos%4 != 0 {
 		return
 	}
+	if d.blockSize == 0 {
+		err = newOpError("directory block size is zero")
+		return
+	}
+	if end > len(d.data) {
+		end = len(d.data)
+	}
 	for {
-		if d.dirPos >= int(d.dataSize) {
+		if d.dirPos >= end {
 			// end of the directory
 			return
 		}
 		if int(d.blockSize)-(d.dirPos%int(d.blockSize)) < 9 {
 			fType = fspEntryTypeSkip
+		} else if d.dirPos+9 > end {
+			err = newOpError("directory entry truncated")
+			return
 		} else {
 			fType = d.data[d.dirPos+8]
 		}
 		if fType == fspEntryTypeEnd {
-			d.dirPos = int(d.dataSize)
+			d.dirPos = end
 			continue
 		}
 		if fType == fspEntryTypeSkip {
 			d.dirPos = (d.dirPos/int(d.blockSize) + 1) * int(d.blockSize)
 			continue
 		}
-		if entry == nil {
-			entry = &dirEntry{}
-		}
+		entry = &dirEntry{}
 		entry.LastModify = int64(binary.BigEndian.Uint32(d.data[d.dirPos:]))
-		entry.Size = uint(binary.BigEndian.Uint32(d.data[d.dirPos+4:]))
+		entry.Size = int64(binary.BigEndian.Uint32(d.data[d.dirPos+4:]))
 		entry.Type = fType
 		d.dirPos += 9
-		for l := d.dirPos; l < int(d.dataSize); l++ {
-			if d.data[d.dirPos+nameLen] == 0 {
-				break
-			}
-			nameLen++
+		nameLen = bytes.IndexByte(d.data[d.dirPos:end], 0)
+		if nameLen < 0 {
+			entry = nil
+			err = newOpError("directory entry name not terminated")
+			return
 		}
-		if nameLen <= 0 {
+		if nameLen == 0 {
 			entry = nil
 			return
 		}
@@ -148,8 +161,9 @@ type File struct {
 	eof     bool
 	err     uint8
 	buffPos int
-	pos     uint32
+	pos     int64
 	out     fspPacket
+	limit   *RateLimiter // limit of this transfer, nil if none
 }
 
 // Read bytes from the file
@@ -160,7 +174,10 @@ func (f *File) Read(buff []byte, size, count int) (done int, err error) {
 		return
 	}
 	for {
-		f.out.pos = f.pos
+		err = f.seek(1)
+		if err != nil {
+			return
+		}
 		resp, err = f.s.transaction(&f.out)
 		if err != nil {
 			return
@@ -169,7 +186,8 @@ func (f *File) Read(buff []byte, size, count int) (done int, err error) {
 			f.eof = true
 			return
 		}
-		f.pos += uint32(resp.len)
+		f.wait(int(resp.len))
+		f.pos += int64(resp.len)
 		copy(buff[done:], resp.buf[:resp.len])
 		done += int(resp.len)
 		if done >= total {
@@ -183,7 +201,11 @@ func (f *File) Read(buff []byte, size, count int) (done int, err error) {
 func (f *File) Write(buff []byte) (err error) {
 	var total, done int
 	var freeBytes, pos int
-	if f.eof || f.err != 0 {
+	if f.err != 0 {
+		err = newOpError("write to failed upload")
+		return
+	}
+	if f.eof {
 		return
 	}
 	if len(f.out.buf) == 0 {
@@ -195,14 +217,17 @@ func (f *File) Write(buff []byte) (err error) {
 	pos = 0
 	for {
 		if f.buffPos >= FSPSpace {
-			f.out.pos = f.pos
-			_, err = f.s.transaction(&f.out)
+			f.wait(int(f.out.len))
+			err = f.seek(int(f.out.len))
+			if err == nil {
+				_, err = f.s.transaction(&f.out)
+			}
 			if err != nil {
 				f.err = 1
 				break
 			}
 			f.buffPos = 0
-			f.pos += uint32(f.out.len)
+			f.pos += int64(f.out.len)
 			done += int(f.out.len)
 		}
 		freeBytes = FSPSpace - f.buffPos
@@ -229,15 +254,18 @@ func (f *File) Flush() (err error) {
 	if f.eof || f.buffPos == 0 {
 		return
 	}
-	f.out.pos = f.pos
+	f.wait(f.buffPos)
 	f.out.len = uint16(f.buffPos)
-	_, err = f.s.transaction(&f.out)
+	err = f.seek(int(f.out.len))
+	if err == nil {
+		_, err = f.s.transaction(&f.out)
+	}
 	if err != nil {
 		f.err = 1
 		return
 	}
 	f.buffPos = 0
-	f.pos += uint32(f.out.len)
+	f.pos += int64(f.out.len)
 	return
 }
 
@@ -257,7 +285,19 @@ func (f *File) install(timeStamp int64) (err error) {
 		out.xlen = 4
 		out.pos = 4
 	}
-	_, err = f.s.transaction(&f.out)
+	f.s.cache.invalidate(f.name)
+	_, err = f.s.transaction(&out)
+	return
+}
+
+// abort cancel upload, the server remove the data sent so far
+func (f *File) abort() (err error) {
+	var out fspPacket
+	f.err = 1
+	out.cmd = FSPCommandInstall
+	out.buf = []byte{0}
+	out.len = 1
+	_, err = f.s.transaction(&out)
 	return
 }
 
@@ -268,6 +308,9 @@ func (f *File) Close() (err error) {
 		if err == nil {
 			err = f.install(time.Now().Unix())
 		}
+		if err != nil {
+			f.abort()
+		}
 	}
 	return
 }
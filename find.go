@@ -0,0 +1,105 @@
+package fsp
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FindOptions predicates of Find, zero fields match everything
+type FindOptions struct {
+	Name      string         // path.Match pattern of the base name
+	Regexp    *regexp.Regexp // matched against the full remote path
+	Type      string         // "file", "dir" or "link" like EntryType, empty for any
+	MinSize   int64          // size at least MinSize bytes
+	MaxSize   int64          // size at most MaxSize bytes, 0 no limit
+	Empty     bool           // only files of zero size
+	NewerThan time.Time      // modified after NewerThan
+	OlderThan time.Time      // modified before OlderThan
+	MaxDepth  int            // levels below root to descend, 0 no limit
+}
+
+// Match report whether the entry name with info fi pass all predicates
+func (o *FindOptions) Match(name string, fi os.FileInfo) bool {
+	if o.Name != "" {
+		if ok, _ := path.Match(o.Name, path.Base(name)); !ok {
+			return false
+		}
+	}
+	if o.Regexp != nil && !o.Regexp.MatchString(name) {
+		return false
+	}
+	if o.Type != "" && EntryType(fi) != o.Type {
+		return false
+	}
+	if fi.Size() < o.MinSize || (o.MaxSize > 0 && fi.Size() > o.MaxSize) {
+		return false
+	}
+	if o.Empty && (fi.IsDir() || fi.Size() != 0) {
+		return false
+	}
+	if !o.NewerThan.IsZero() && !fi.ModTime().After(o.NewerThan) {
+		return false
+	}
+	if !o.OlderThan.IsZero() && !fi.ModTime().Before(o.OlderThan) {
+		return false
+	}
+	return true
+}
+
+// Find walk root and call fn for every entry below root matching opts, in
+// the order of WalkDir. fn may return fs.SkipDir or fs.SkipAll. Directories
+// which can not be listed are skipped, the first such error is returned
+// after the walk. An invalid Name pattern return path.ErrBadPattern.
+func (s *Session) Find(root string, opts *FindOptions, fn func(name string, fi os.FileInfo) error) (err error) {
+	var listErr error
+	var depth = strings.Count(cleanPath(root), "/")
+	if cleanPath(root) == "/" {
+		depth = 0
+	}
+	if opts == nil {
+		opts = &FindOptions{}
+	}
+	if _, err = path.Match(opts.Name, ""); err != nil {
+		return
+	}
+	err = s.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		var fi os.FileInfo
+		if err != nil {
+			if listErr == nil {
+				listErr = err
+			}
+			if d == nil {
+				return err
+			}
+			return fs.SkipDir
+		}
+		if name == root {
+			return nil
+		}
+		if fi, err = d.Info(); err != nil {
+			return err
+		}
+		var level = strings.Count(cleanPath(name), "/") - depth
+		if opts.MaxDepth > 0 && level > opts.MaxDepth {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if opts.Match(name, fi) {
+			err = fn(name, fi)
+		}
+		if err == nil && d.IsDir() && opts.MaxDepth > 0 && level == opts.MaxDepth {
+			err = fs.SkipDir
+		}
+		return err
+	})
+	if err == nil {
+		err = listErr
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package fsp_test
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// findNames return the names found by Find
+func findNames(t *testing.T, s *fsp.Session, root string, opts *fsp.FindOptions) string {
+	var names []string
+	t.Helper()
+	err := s.Find(root, opts, func(name string, fi os.FileInfo) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestFind(t *testing.T) {
+	var srv, s = startServer(t)
+	var now = time.Now()
+	srv.WriteFile("/f/a.log", make([]byte, 100), now.Add(-48*time.Hour))
+	srv.WriteFile("/f/b.txt", make([]byte, 5000), now)
+	srv.WriteFile("/f/empty.log", nil, now)
+	srv.WriteFile("/f/sub/c.log", make([]byte, 10), now)
+	srv.WriteFile("/f/sub/deep/d.log", make([]byte, 10), now)
+	var tests = []struct {
+		opts fsp.FindOptions
+		want string
+	}{
+		{fsp.FindOptions{Name: "*.log"}, "/f/a.log /f/empty.log /f/sub/c.log /f/sub/deep/d.log"},
+		{fsp.FindOptions{Name: "*.log", MaxDepth: 1}, "/f/a.log /f/empty.log"},
+		{fsp.FindOptions{Type: "dir"}, "/f/sub /f/sub/deep"},
+		{fsp.FindOptions{MinSize: 1000}, "/f/b.txt"},
+		{fsp.FindOptions{Type: "file", MaxSize: 50}, "/f/empty.log /f/sub/c.log /f/sub/deep/d.log"},
+		{fsp.FindOptions{Empty: true}, "/f/empty.log"},
+		{fsp.FindOptions{OlderThan: now.Add(-time.Hour)}, "/f/a.log"},
+		{fsp.FindOptions{Type: "file", NewerThan: now.Add(-time.Hour), Regexp: regexp.MustCompile(`/sub/`)}, "/f/sub/c.log /f/sub/deep/d.log"},
+	}
+	for _, tt := range tests {
+		if got := findNames(t, s, "/f", &tt.opts); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestFindBadPattern(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.WriteFile("/f/a.log", nil, time.Now())
+	var err = s.Find("/f", &fsp.FindOptions{Name: "[a-"}, func(name string, fi os.FileInfo) error {
+		t.Errorf("called for %s", name)
+		return nil
+	})
+	if err != path.ErrBadPattern {
+		t.Errorf("got %v, want ErrBadPattern", err)
+	}
+}
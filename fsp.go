@@ -22,6 +22,7 @@ Package fsp provides a interface for connect fsp server
 package fsp
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"net"
@@ -41,40 +42,89 @@ type Error interface {
 	Timeout() bool
 }
 
-// NewSession return a new Session
+// NewSession return a new Session. serverAddress is "host:port",
+// "[ipv6]:port", a host without port for the standard port 21 or a
+// fsp://password@host:port URL whose password is used when password is
+// empty. Names with IPv4 and IPv6 addresses connect to the first that
+// answers.
 func NewSession(serverAddress, password string) (session *Session, err error) {
 	var conn *net.UDPConn
-	conn, err = net.ListenUDP("udp4", nil)
+	var addr *net.UDPAddr
+	var keys *fileKeyStore
+	var host, port, urlPassword string
+	host, port, urlPassword, err = splitServerAddress(serverAddress)
+	if err != nil {
+		return
+	}
+	if password == "" {
+		password = urlPassword
+	}
+	keys, _ = newFileKeyStore()
+	conn, addr, err = dialServer(host, port, keys)
 	if err != nil {
 		return
 	}
-	session, err = NewSessionWithConn(conn, serverAddress, password)
+	session, err = NewSessionWithConn(conn, addr.String(), password)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	session.keys = keys
 	return
 }
 
-// NewSessionWithConn return a new Session
+// NewSessionWithConn return a new Session, the server address is resolved
+// in the address family of conn
 func NewSessionWithConn(conn *net.UDPConn, serverAddress, password string) (session *Session, err error) {
 	var addr *net.UDPAddr
+	var addrs []*net.UDPAddr
+	var host, port, urlPassword string
 	if conn == nil || serverAddress == "" {
 		err = newOpError("invalid conn or server address")
 		return
 	}
-	addr, err = net.ResolveUDPAddr("udp4", serverAddress)
+	host, port, urlPassword, err = splitServerAddress(serverAddress)
+	if err != nil {
+		return
+	}
+	if password == "" {
+		password = urlPassword
+	}
+	addrs, err = resolveServer(host, port)
+	if err != nil {
+		return
+	}
+	addr = addrs[0]
+	if local, ok := conn.LocalAddr().(*net.UDPAddr); ok && local.IP.To4() != nil {
+		// socket of udp4 can not reach IPv6 addresses
+		for _, a := range addrs {
+			if a.IP.To4() != nil {
+				addr = a
+				break
+			}
+		}
+	}
+	session, err = NewSessionWithTransport(NewUDPTransport(conn, addr), password)
 	if err != nil {
 		return
 	}
-	if addr.Port == 0 {
-		err = newOpError("invalid server port")
+	session.serverAddr = addr
+	return
+}
+
+// NewSessionWithTransport return a new Session talking to server through tr
+func NewSessionWithTransport(tr Transport, password string) (session *Session, err error) {
+	if tr == nil {
+		err = newOpError("invalid transport")
 		return
 	}
 	session = &Session{
-		serverAddr: addr,
-		conn:       conn,
-		password:   password,
+		tr:       tr,
+		password: password,
 	}
 	session.loadKey()
 	session.setDefault()
-	session.verbose(0, "connect from %s to %s", session.conn.LocalAddr().String(), session.serverAddr.String())
+	session.verbose(0, "connect %s", tr.String())
 	return
 }
 
@@ -82,7 +132,7 @@ func NewSessionWithConn(conn *net.UDPConn, serverAddress, password string) (sess
 func (s *Session) Close() {
 	var bye fspPacket
 	s.saveKey()
-	if s.conn == nil {
+	if s.tr == nil {
 		return
 	}
 	// send bye
@@ -91,21 +141,17 @@ func (s *Session) Close() {
 	bye.xlen = 0
 	bye.pos = 0
 	s.transaction(&bye)
-	s.conn.Close()
-	s.conn = nil
+	s.tr.Close()
+	s.tr = nil
 }
 
 // Version Get server version string and setup
 func (s *Session) Version() (version string) {
-	var pkt fspPacket
-	pkt.cmd = FSPCommandVersion
-	pkt.xlen = 0
-	pkt.pos = 0
-	resp, err := s.transaction(&pkt)
+	var info, err = s.ServerInfo()
 	if err != nil {
 		return
 	}
-	version = string(resp.buf[:resp.len])
+	version = info.Version
 	return
 }
 
@@ -118,48 +164,68 @@ func (s *Session) Readdir(dirpath string) (fi []os.FileInfo, err error) {
 	if err != nil || di == nil {
 		return
 	}
-	entrys = di.ListEntrys()
+	entrys, err = di.ListEntrys()
 	for _, entry = range entrys {
-		var st fileStat
-		st.name = entry.Name
-		st.modTime = time.Unix(entry.LastModify, 0)
-		st.size = int64(entry.Size)
-		if entry.Type == fspEntryTypeDir {
-			st.mode = os.ModeDir | 0755
-		} else {
-			st.mode = 0644
-		}
+		fi = append(fi, entry.fileInfo())
 	}
 	return
 }
 
-// ShowDir display the files of the dir
-func (s *Session) ShowDir(dirpath string) (err error) {
+// List reads the directory and returns its entries together with the
+// protection byte and per type totals, "." and ".." are left out
+func (s *Session) List(dirpath string) (list *DirList, err error) {
 	var di *dir
-	var numFiles, numDirs, numLinks int
 	var entrys []*dirEntry
 	var entry *dirEntry
 	di, err = s.getDir(dirpath)
 	if err != nil || di == nil {
 		return
 	}
-	entrys = di.ListEntrys()
-	fmt.Printf("[start]\n")
+	if dirpath == "" {
+		dirpath = "/"
+	}
+	entrys, err = di.ListEntrys()
+	if err != nil {
+		return
+	}
+	list = &DirList{Path: dirpath}
 	for _, entry = range entrys {
 		if entry.Name == "." || entry.Name == ".." {
 			continue
 		}
-		if entry.Type == fspEntryTypeFile {
-			numFiles++
-		} else if entry.Type == fspEntryTypeDir {
-			numDirs++
-		} else if entry.Type == fspEntryTypeLink {
-			numLinks++
+		switch entry.Type {
+		case fspEntryTypeFile:
+			list.Files++
+			list.Size += entry.Size
+		case fspEntryTypeDir:
+			list.Dirs++
+		case fspEntryTypeLink:
+			list.Links++
+		default:
+			continue
 		}
-		fmt.Printf("%s\n", entry.Show())
+		list.Entries = append(list.Entries, entry.fileInfo())
+	}
+	// old servers may not answer CC_GET_PRO, the listing is still usable
+	list.Protection, _ = s.GetProtecion(dirpath)
+	return
+}
+
+// ShowDir display the files of the dir
+//
+// Deprecated: use List and format the result.
+func (s *Session) ShowDir(dirpath string) (err error) {
+	var list *DirList
+	list, err = s.List(dirpath)
+	if err != nil || list == nil {
+		return
+	}
+	fmt.Printf("[start]\n")
+	for _, fi := range list.Entries {
+		fmt.Printf("%s\n", EntryString(fi))
 	}
 	fmt.Printf("[end]\n")
-	fmt.Printf("file-%d, link-%d, dir-%d\n", numFiles, numLinks, numDirs)
+	fmt.Printf("file-%d, link-%d, dir-%d\n", list.Files, list.Links, list.Dirs)
 	return
 }
 
@@ -170,19 +236,25 @@ func (s *Session) DwonloadFile(remotePath, savePath string, retry int) (err erro
 	if err != nil {
 		return
 	}
+	if s.skipSame && unchanged(saveFileName(remotePath, savePath), stat) {
+		s.verbose(0, "file %s not changed", remotePath)
+		return
+	}
 	s.startDownload(stat.Size())
 	err = s.getFile(remotePath, savePath, retry)
 	s.finishDownload()
 	return
 }
 
-// DownloadDirectory download dir from fsp server
+// DownloadDirectory download the files of dir from fsp server. A failed file
+// does not stop the others, the returned error list every failed file.
 func (s *Session) DownloadDirectory(remotePath, savePath string) (err error) {
 	var di *dir
-	var totalSize, totalCount int
-	var saveDir, getFile, saveFile, tmpSaveFile string
+	var saveDir, saveFile string
 	var entrys []*dirEntry
 	var finfo os.FileInfo
+	var report *TransferReport
+	var manager = NewTransferManager(s, 1)
 	if savePath == "" {
 		if remotePath[0] == '/' {
 			saveDir = remotePath[1:]
@@ -196,54 +268,49 @@ func (s *Session) DownloadDirectory(remotePath, savePath string) (err error) {
 	if err != nil {
 		return
 	}
-	entrys = di.ListEntrys()
-	for _, entry := range entrys {
-		if entry.Type == fspEntryTypeFile {
-			totalCount++
-			totalSize += int(entry.Size)
-		}
+	entrys, err = di.ListEntrys()
+	if err != nil {
+		return
 	}
-	s.startDownload(int64(totalSize))
 	for _, entry := range entrys {
 		if entry.Type != fspEntryTypeFile {
 			continue
 		}
-		getFile = filepath.Join(remotePath, entry.Name)
 		saveFile = filepath.Join(saveDir, entry.Name)
-		tmpSaveFile = saveFile + ".tmp"
-		if finfo, err = os.Stat(saveFile); err == nil && finfo.Size() == int64(entry.Size) {
+		if s.skipSame {
+			if unchanged(saveFile, entry.fileInfo()) {
+				s.verbose(0, "file %s not changed", saveFile)
+				continue
+			}
+		} else if finfo, err = os.Stat(saveFile); err == nil && finfo.Size() == entry.Size {
 			s.verbose(0, "file %s already download", saveFile)
-			s.trans.updateUnit(0, int64(entry.Size))
 			continue
 		}
-		err = s.getFile(getFile, tmpSaveFile, 3)
-		if err != nil {
-			s.verbose(0, "file %s download fail, %v", getFile, err)
-			break
-		}
-		err = os.Rename(tmpSaveFile, saveFile)
-		if err != nil {
-			s.verbose(0, "rename file %s to %s fail, %v", tmpSaveFile, saveFile, err)
+		manager.Add(TransferJob{
+			Remote: filepath.Join(remotePath, entry.Name),
+			Local:  saveFile,
+		})
+	}
+	report = manager.Run()
+	for _, res := range report.Results {
+		if res.Err != nil {
+			s.verbose(0, "file %s download fail, %v", res.Job.Remote, res.Err)
 		} else {
-			fmt.Printf("get file %s done\n", entry.Name)
+			fmt.Printf("get file %s done\n", filepath.Base(res.Job.Remote))
 		}
 	}
-	s.finishDownload()
-	return
+	return report.Err()
 }
 
 // Mkdir create a directory
 func (s *Session) Mkdir(directory string) (err error) {
+	s.cache.invalidate(directory)
 	return s.simpleCommand(directory, FSPCommandMakeDir)
 }
 
-// RemoveAll delete a directory
-func (s *Session) RemoveAll(path string) (err error) {
-	return s.simpleCommand(path, FSPCommandDelDir)
-}
-
 // Remove delete a file
 func (s *Session) Remove(name string) (err error) {
+	s.cache.invalidate(name)
 	return s.simpleCommand(name, FSPCommandDelFile)
 }
 
@@ -254,37 +321,34 @@ func (s *Session) Rename(oldpath, newpath string) (err error) {
 	if err != nil {
 		return
 	}
-	if (len(newpath) + int(out.len)) > FSPSpace {
-		err = newOpError("file name too long")
+	// xtra data: ASCIIZ destination, with password like the source name
+	if len(newpath)+len(s.password)+2+int(out.len) > FSPSpace {
+		err = newKindError(ErrNameTooLong, "file name too long")
 		return
 	}
-	copy(out.buf[out.len:], newpath[:])
+	out.buf = append(out.buf, newpath...)
 	out.xlen = uint16(len(newpath))
 	if s.password != "" {
-		if out.len+out.xlen > FSPSpace {
-			err = newOpError("file name too long")
-			return
-		}
 		out.buf = append(out.buf, '\n')
-		out.xlen += uint16(1)
-		copy(out.buf[out.len+out.xlen:], s.password[:])
-		out.xlen += uint16(len(s.password))
+		out.buf = append(out.buf, s.password...)
+		out.xlen += uint16(len(s.password) + 1)
 	}
 	out.buf = append(out.buf, 0)
 	out.xlen += uint16(1)
 	out.cmd = FSPCommandRename
 	out.pos = uint32(out.xlen)
+	s.cache.invalidate(oldpath)
+	s.cache.invalidate(newpath)
 	_, err = s.transaction(&out)
 	return
 }
 
-// UploadFile upload file to fsp server
+// UploadFile upload file to fsp server, it is installed with the current
+// time, use Upload with UploadOptions.ModTime to keep the local time
 func (s *Session) UploadFile(localFile, remotePath string) (err error) {
 	var fp *os.File
-	var fspFile *File
+	var opts = UploadOptions{Atomic: s.atomic}
 	var fileName = filepath.Base(localFile)
-	var buff []byte
-	var done int
 	if len(remotePath) == 0 {
 		remotePath = fileName
 	} else if os.IsPathSeparator(remotePath[len(remotePath)-1]) {
@@ -293,32 +357,11 @@ func (s *Session) UploadFile(localFile, remotePath string) (err error) {
 	s.verbose(0, "start upload %s to %s\n", localFile, remotePath)
 	fp, err = os.Open(localFile)
 	if err != nil || fp == nil {
-		err = newOpError("local file not exist")
+		err = newKindError(ErrNotExist, "local file not exist")
 		return
 	}
 	defer fp.Close()
-	fspFile, err = s.openFile(remotePath, "w")
-	if err != nil {
-		return
-	}
-	defer fspFile.Close()
-	buff = make([]byte, 1024)
-	for {
-		done, err = fp.Read(buff)
-		if err != nil {
-			if err.Error() == "EOF" {
-				err = nil
-			} else {
-				err = newOpError(err.Error())
-			}
-			break
-		}
-		if done > 0 {
-			fspFile.Write(buff[:done])
-		} else {
-			break
-		}
-	}
+	_, err = s.Upload(context.Background(), remotePath, fp, &opts)
 	return
 }
 
@@ -330,6 +373,9 @@ func (s *Session) GetProtecion(directory string) (protection uint8, err error) {
 	if err != nil {
 		return
 	}
+	if cached, ok := s.cache.get(cachePro, directory).(uint8); ok {
+		return cached, nil
+	}
 	out.cmd = FSPCommandGetPro
 	out.xlen = 0
 	out.pos = 0
@@ -338,11 +384,12 @@ func (s *Session) GetProtecion(directory string) (protection uint8, err error) {
 	if err != nil {
 		return
 	}
-	if resp.pos != FSPProBytes {
+	if resp.pos != FSPProBytes || resp.xlen < FSPProBytes {
 		err = newOpError("GetProtecion ENOMSG")
 		return
 	}
 	protection = resp.buf[resp.len]
+	s.cache.put(cachePro, directory, protection)
 	return
 }
 
@@ -351,6 +398,9 @@ func (s *Session) Stat(name string) (info os.FileInfo, err error) {
 	var st fileStat
 	var out fspPacket
 	var resp fspPacket
+	if info = s.cachedStat(name); info != nil {
+		return
+	}
 	err = out.buildFileName(name, s.password)
 	if err != nil {
 		return
@@ -363,7 +413,7 @@ func (s *Session) Stat(name string) (info os.FileInfo, err error) {
 		return
 	}
 	if len(resp.buf) <= 8 || resp.buf[8] == 0 {
-		err = newOpError("No such file")
+		err = newKindError(ErrNotExist, "No such file")
 		return
 	}
 	var modTime = binary.BigEndian.Uint32(resp.buf[:4])
@@ -375,6 +425,7 @@ func (s *Session) Stat(name string) (info os.FileInfo, err error) {
 	} else {
 		st.mode = 0644
 	}
+	s.cache.put(cacheStat, name, st)
 	return st, nil
 }
 
@@ -390,7 +441,7 @@ func (s *Session) CanUpload(fileName string) (err error) {
 		return
 	}
 	if protection&FSPDirAdd == 0 {
-		err = newOpError("files cann't be added to this dir")
+		err = newKindError(ErrPermission, "files cann't be added to this dir")
 		return
 	}
 	if protection&FSPDirDel > 0 {
@@ -398,7 +449,7 @@ func (s *Session) CanUpload(fileName string) (err error) {
 	}
 	_, err = s.Stat(fileName)
 	if err == nil {
-		err = newOpError("file exist already")
+		err = newKindError(ErrExist, "file exist already")
 	} else {
 		err = nil
 	}
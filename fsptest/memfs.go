@@ -0,0 +1,121 @@
+package fsptest
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// protection of new directories
+const proDefault = fsp.FSPDirOwner | fsp.FSPDirDel | fsp.FSPDirAdd | fsp.FSPDirMkDir | fsp.FSPDirList | fsp.FSPDirRename
+
+// node file or directory of the in-memory filesystem
+type node struct {
+	dir        bool
+	data       []byte
+	modTime    time.Time
+	protection uint8
+}
+
+// memFS in-memory filesystem served by Server, all names are clean
+// absolute slash separated paths
+type memFS struct {
+	mu    sync.Mutex
+	nodes map[string]*node
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		nodes: map[string]*node{
+			"/": {dir: true, modTime: time.Now(), protection: proDefault},
+		},
+	}
+}
+
+// cleanName turn a request file name into a key of nodes
+func cleanName(name string) string {
+	return path.Clean("/" + name)
+}
+
+func (m *memFS) lookup(name string) *node {
+	return m.nodes[cleanName(name)]
+}
+
+// children return sorted names of the entries of dir
+func (m *memFS) children(dir string) (names []string) {
+	dir = cleanName(dir)
+	var prefix = dir + "/"
+	if dir == "/" {
+		prefix = "/"
+	}
+	for name := range m.nodes {
+		if name == dir || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if rest := name[len(prefix):]; !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// mkdirAll create dir and missing parents
+func (m *memFS) mkdirAll(dir string, modTime time.Time) {
+	dir = cleanName(dir)
+	if n := m.nodes[dir]; n != nil {
+		return
+	}
+	m.mkdirAll(path.Dir(dir), modTime)
+	m.nodes[dir] = &node{dir: true, modTime: modTime, protection: proDefault}
+}
+
+// WriteFile create or replace a file, missing parent directories are created
+func (s *Server) WriteFile(name string, data []byte, modTime time.Time) {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	name = cleanName(name)
+	s.fs.mkdirAll(path.Dir(name), modTime)
+	s.fs.nodes[name] = &node{data: append([]byte(nil), data...), modTime: modTime}
+}
+
+// Mkdir create a directory and its missing parents
+func (s *Server) Mkdir(name string) {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	s.fs.mkdirAll(name, time.Now())
+}
+
+// SetProtection set the protection byte of a directory
+func (s *Server) SetProtection(dir string, protection uint8) {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	if n := s.fs.lookup(dir); n != nil && n.dir {
+		n.protection = protection
+	}
+}
+
+// ReadFile return the content of a file
+func (s *Server) ReadFile(name string) (data []byte, err error) {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	var n = s.fs.lookup(name)
+	if n == nil || n.dir {
+		err = os.ErrNotExist
+		return
+	}
+	data = append([]byte(nil), n.data...)
+	return
+}
+
+// Exists check if a file or directory exists
+func (s *Server) Exists(name string) bool {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	return s.fs.lookup(name) != nil
+}
@@ -0,0 +1,528 @@
+/*
+Package fsptest provides an in-process FSP server for testing code that
+uses the fsp package. The server listens on a localhost UDP port, serves
+an in-memory filesystem and can inject network faults. It can also answer
+on any fsp.Transport, for example one end of fsp.NewPipe, with Serve.
+
+	srv, err := fsptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.WriteFile("/pub/hello.txt", []byte("hello"), time.Now())
+	srv.SetFaults(fsptest.Faults{Loss: 0.2, Seed: 1})
+	session, err := fsp.NewSession(srv.Addr, "")
+*/
+package fsptest
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// default size of directory block and file data
+const defaultBlock = 1024
+
+// types of directory entry
+const (
+	rdTypeEnd  = 0x00
+	rdTypeFile = 0x01
+	rdTypeDir  = 0x02
+	rdTypeSkip = 0x2A
+)
+
+// error status codes sent in CC_ERR extra data, errno values
+const (
+	codeNotExist   = 2
+	codePermission = 13
+	codeExist      = 17
+	codeNotDir     = 20
+	codeIsDir      = 21
+	codeInvalid    = 22
+	codeNotEmpty   = 39
+)
+
+// Faults network faults injected by Server. Probabilities are in range
+// 0..1, the random source is seeded with Seed so a test run is repeatable.
+type Faults struct {
+	Loss      float64       // drop a request or its reply
+	Duplicate float64       // send a reply twice
+	Reorder   float64       // hold a reply back and send it after the next one
+	Corrupt   float64       // send a reply with wrong checksum
+	Delay     time.Duration // wait before sending each reply
+	KeyChange bool          // use a new key for every reply
+	Seed      int64
+}
+
+// client state of one client address
+type client struct {
+	key    uint16
+	oldKey uint16 // accepted for resent requests
+	upload []byte
+}
+
+// Server scripted FSP server backed by an in-memory filesystem
+type Server struct {
+	Addr string // host:port of the server
+
+	mu         sync.Mutex
+	conn       *net.UDPConn
+	fs         *memFS
+	faults     Faults
+	rnd        *rand.Rand
+	clients    map[string]*client
+	held       []byte // reply held back for reordering
+	heldSend   func([]byte)
+	requests   int
+	version    string
+	flags      uint8
+	maxThruput uint32
+	maxPayload uint16
+	password   string
+	noReplace  bool
+	done       chan struct{}
+}
+
+// NewServer start a server on a random localhost port
+func NewServer() (s *Server, err error) {
+	var conn *net.UDPConn
+	conn, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return
+	}
+	s = &Server{
+		Addr:    conn.LocalAddr().String(),
+		conn:    conn,
+		fs:      newMemFS(),
+		rnd:     rand.New(rand.NewSource(1)),
+		clients: make(map[string]*client),
+		version: "fsptest",
+		done:    make(chan struct{}),
+	}
+	go s.serve()
+	return
+}
+
+// Close stop the server
+func (s *Server) Close() {
+	s.conn.Close()
+	<-s.done
+}
+
+// SetFaults replace the injected faults and reseed the random source
+func (s *Server) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+	s.rnd = rand.New(rand.NewSource(f.Seed))
+}
+
+// SetVersion set the CC_VERSION reply, thruput and payload are sent when
+// flags has bit 4 set
+func (s *Server) SetVersion(version string, flags uint8, maxThruput uint32, maxPayload uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+	s.flags = flags
+	s.maxThruput = maxThruput
+	s.maxPayload = maxPayload
+}
+
+// SetPassword require password for every file name, empty disable it
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// SetNoReplace make CC_RENAME refuse to replace an existing file, like
+// servers built on a rename that fail with EEXIST
+func (s *Server) SetNoReplace(noReplace bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noReplace = noReplace
+}
+
+// Requests return the number of valid requests received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) serve() {
+	defer close(s.done)
+	var buff = make([]byte, 65536)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buff)
+		if err != nil {
+			return
+		}
+		s.handle(buff[:n], addr.String(), func(b []byte) {
+			s.conn.WriteToUDP(b, addr)
+		})
+	}
+}
+
+// Serve answer requests arriving on tr until it is closed, so the server
+// can be reached by a session built with fsp.NewSessionWithTransport
+func (s *Server) Serve(tr fsp.Transport) {
+	var buff = make([]byte, 65536)
+	for {
+		n, err := tr.Receive(buff, time.Time{})
+		if err != nil {
+			return
+		}
+		s.handle(buff[:n], tr.String(), func(b []byte) {
+			tr.Send(b)
+		})
+	}
+}
+
+func (s *Server) chance(p float64) bool {
+	return p > 0 && s.rnd.Float64() < p
+}
+
+func (s *Server) handle(buff []byte, from string, send func([]byte)) {
+	var req, reply *fsp.Packet
+	var err error
+	var out []byte
+	req, err = fsp.DecodeRequest(buff)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.chance(s.faults.Loss) {
+		return
+	}
+	var c = s.clients[from]
+	if c == nil {
+		c = &client{key: req.Key, oldKey: req.Key}
+		s.clients[from] = c
+	}
+	if req.Key != c.key && req.Key != c.oldKey {
+		// wrong key, the real server ignores such requests
+		return
+	}
+	reply = s.process(c, req)
+	reply.Seq = req.Seq
+	if req.Cmd == fsp.FSPCommandBye {
+		delete(s.clients, from)
+	} else if s.faults.KeyChange && req.Key == c.key {
+		// a resent request with the old key keeps the current key
+		c.oldKey = c.key
+		c.key = uint16(s.rnd.Intn(65536))
+	}
+	reply.Key = c.key
+	out, err = fsp.EncodeReply(reply)
+	if err != nil {
+		return
+	}
+	if s.chance(s.faults.Corrupt) {
+		out[1]++
+	}
+	if s.chance(s.faults.Loss) {
+		return
+	}
+	if s.chance(s.faults.Reorder) && s.held == nil {
+		s.held, s.heldSend = out, send
+		return
+	}
+	var sends = [][]byte{out}
+	if s.chance(s.faults.Duplicate) {
+		sends = append(sends, out)
+	}
+	if s.faults.Delay > 0 {
+		time.Sleep(s.faults.Delay)
+	}
+	for _, b := range sends {
+		send(b)
+	}
+	if s.held != nil {
+		s.heldSend(s.held)
+		s.held, s.heldSend = nil, nil
+	}
+}
+
+func errorReply(code uint16, msg string) *fsp.Packet {
+	var xtra = make([]byte, 2)
+	binary.BigEndian.PutUint16(xtra, code)
+	return &fsp.Packet{Cmd: fsp.FSPCommandErr, Pos: 2, Data: append([]byte(msg), 0), Xtra: xtra}
+}
+
+// asciiz cut string at first NUL
+func asciiz(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// fileName parse "name\npassword" of a request, ok is false on bad password
+func (s *Server) fileName(b []byte) (name string, ok bool) {
+	var password string
+	name = asciiz(b)
+	if n := strings.IndexByte(name, '\n'); n >= 0 {
+		name, password = name[:n], name[n+1:]
+	}
+	return cleanName(name), password == s.password
+}
+
+// preferred size word of extra data
+func preferredSize(xtra []byte, def int) int {
+	if len(xtra) >= 2 {
+		if n := int(binary.BigEndian.Uint16(xtra)); n > 0 && n <= fsp.FSPSpace {
+			return n
+		}
+	}
+	return def
+}
+
+func (s *Server) process(c *client, req *fsp.Packet) *fsp.Packet {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+	var reply = &fsp.Packet{Cmd: req.Cmd}
+	switch req.Cmd {
+	case fsp.FSPCommandVersion:
+		reply.Data = append([]byte(s.version), 0)
+		reply.Xtra = []byte{s.flags}
+		if s.flags&0x10 != 0 {
+			var thruput = make([]byte, 6)
+			binary.BigEndian.PutUint32(thruput, s.maxThruput)
+			binary.BigEndian.PutUint16(thruput[4:], s.maxPayload)
+			reply.Xtra = append(reply.Xtra, thruput...)
+		}
+		reply.Pos = uint32(len(reply.Xtra))
+		return reply
+	case fsp.FSPCommandBye:
+		return reply
+	case fsp.FSPCommandInstall:
+		if asciiz(req.Data) == "" {
+			// cancel upload, no password is sent
+			c.upload = nil
+			return reply
+		}
+	case fsp.FSPCommandUpload:
+		if req.Pos == 0 {
+			c.upload = c.upload[:0]
+		}
+		if int(req.Pos) > len(c.upload) {
+			return errorReply(codeInvalid, "bad upload position")
+		}
+		c.upload = append(c.upload[:req.Pos], req.Data...)
+		reply.Pos = req.Pos
+		return reply
+	}
+	var name, ok = s.fileName(req.Data)
+	if !ok {
+		return errorReply(codePermission, "permission denied")
+	}
+	var n = s.fs.lookup(name)
+	switch req.Cmd {
+	case fsp.FSPCommandGetDir:
+		if n == nil || !n.dir {
+			return errorReply(codeNotExist, "no such directory")
+		}
+		var block = preferredSize(req.Xtra, defaultBlock)
+		var listing = s.listing(name, block)
+		reply.Pos = req.Pos
+		if int(req.Pos) < len(listing) {
+			var end = int(req.Pos) + block
+			if end > len(listing) {
+				end = len(listing)
+			}
+			reply.Data = listing[req.Pos:end]
+		}
+	case fsp.FSPCommandGetFile, fsp.FSPCommandGrabFile:
+		if n == nil || n.dir {
+			return errorReply(codeNotExist, "no such file")
+		}
+		var size = preferredSize(req.Xtra, defaultBlock)
+		reply.Pos = req.Pos
+		if int(req.Pos) < len(n.data) {
+			var end = int(req.Pos) + size
+			if end > len(n.data) {
+				end = len(n.data)
+			}
+			reply.Data = n.data[req.Pos:end]
+		}
+	case fsp.FSPCommandGrabDone:
+		if n == nil || n.dir {
+			return errorReply(codeNotExist, "no such file")
+		}
+		delete(s.fs.nodes, name)
+	case fsp.FSPCommandInstall:
+		var parent = s.fs.lookup(path.Dir(name))
+		if parent == nil || !parent.dir {
+			return errorReply(codeNotExist, "no such directory")
+		}
+		if n != nil && n.dir {
+			return errorReply(codeIsDir, "is a directory")
+		}
+		var modTime = time.Now()
+		if len(req.Xtra) >= 4 {
+			modTime = time.Unix(int64(binary.BigEndian.Uint32(req.Xtra)), 0)
+		}
+		s.fs.nodes[name] = &node{data: append([]byte(nil), c.upload...), modTime: modTime}
+		c.upload = nil
+	case fsp.FSPCommandDelFile:
+		if n == nil {
+			return errorReply(codeNotExist, "no such file")
+		}
+		if n.dir {
+			return errorReply(codeIsDir, "is a directory")
+		}
+		delete(s.fs.nodes, name)
+	case fsp.FSPCommandDelDir:
+		if n == nil {
+			return errorReply(codeNotExist, "no such directory")
+		}
+		if !n.dir {
+			return errorReply(codeNotDir, "not a directory")
+		}
+		if len(s.fs.children(name)) > 0 {
+			return errorReply(codeNotEmpty, "directory not empty")
+		}
+		delete(s.fs.nodes, name)
+	case fsp.FSPCommandMakeDir:
+		if n != nil {
+			return errorReply(codeExist, "file exists")
+		}
+		var parent = s.fs.lookup(path.Dir(name))
+		if parent == nil || !parent.dir {
+			return errorReply(codeNotExist, "no such directory")
+		}
+		n = &node{dir: true, modTime: time.Now(), protection: proDefault}
+		s.fs.nodes[name] = n
+		return proReply(req.Cmd, n)
+	case fsp.FSPCommandGetPro, fsp.FSPCommandSetPro:
+		if n == nil || !n.dir {
+			return errorReply(codeNotExist, "no such directory")
+		}
+		if req.Cmd == fsp.FSPCommandSetPro && len(req.Xtra) >= 2 {
+			setPro(n, req.Xtra[0], req.Xtra[1])
+		}
+		reply = proReply(req.Cmd, n)
+	case fsp.FSPCommandStat:
+		reply.Data = make([]byte, 9)
+		if n != nil {
+			binary.BigEndian.PutUint32(reply.Data, uint32(n.modTime.Unix()))
+			binary.BigEndian.PutUint32(reply.Data[4:], uint32(len(n.data)))
+			reply.Data[8] = rdTypeFile
+			if n.dir {
+				reply.Data[8] = rdTypeDir
+			}
+		}
+	case fsp.FSPCommandRename:
+		var target, ok = s.fileName(req.Xtra)
+		if !ok {
+			return errorReply(codePermission, "permission denied")
+		}
+		if n == nil {
+			return errorReply(codeNotExist, "no such file")
+		}
+		if t := s.fs.lookup(target); t != nil && (t.dir || n.dir || s.noReplace) {
+			// like rename(2) a file replace a file, nothing replace a directory
+			return errorReply(codeExist, "file exists")
+		}
+		var moved = make(map[string]*node)
+		for key, value := range s.fs.nodes {
+			if key == name || strings.HasPrefix(key, name+"/") {
+				moved[target+key[len(name):]] = value
+				delete(s.fs.nodes, key)
+			}
+		}
+		for key, value := range moved {
+			s.fs.nodes[key] = value
+		}
+	default:
+		return errorReply(codeInvalid, "unknown command")
+	}
+	return reply
+}
+
+// proReply reply of cmd carrying protection like CC_GET_PRO, empty readme
+// and one protection byte
+func proReply(cmd uint8, n *node) *fsp.Packet {
+	return &fsp.Packet{Cmd: cmd, Pos: 1, Data: []byte{0}, Xtra: []byte{n.protection}}
+}
+
+// setPro apply CC_SET_PRO command like "+c"
+func setPro(n *node, op, flag byte) {
+	var bit uint8
+	switch flag {
+	case 'c':
+		bit = fsp.FSPDirAdd
+	case 'd':
+		bit = fsp.FSPDirDel
+	case 'm':
+		bit = fsp.FSPDirMkDir
+	case 'l':
+		bit = fsp.FSPDirList
+	case 'r':
+		bit = fsp.FSPDirRename
+	default:
+		return
+	}
+	if op == '+' {
+		n.protection |= bit
+	} else {
+		n.protection &^= bit
+	}
+}
+
+// listing encode directory name as RDIRENT blocks of block bytes
+func (s *Server) listing(name string, block int) (buff []byte) {
+	var pad = func() {
+		for len(buff)%4 != 0 {
+			buff = append(buff, 0)
+		}
+	}
+	var header = func(t uint8, modTime time.Time, size int) {
+		var h = make([]byte, 9)
+		binary.BigEndian.PutUint32(h, uint32(modTime.Unix()))
+		binary.BigEndian.PutUint32(h[4:], uint32(size))
+		h[8] = t
+		buff = append(buff, h...)
+	}
+	// nextBlock make sure need bytes fit in current block
+	var nextBlock = func(need int) {
+		var left = block - len(buff)%block
+		if left >= need {
+			return
+		}
+		if left >= 9 {
+			header(rdTypeSkip, time.Time{}, 0)
+		}
+		for len(buff)%block != 0 {
+			buff = append(buff, 0)
+		}
+	}
+	for _, child := range s.fs.children(name) {
+		var n = s.fs.lookup(path.Join(name, child))
+		var t uint8 = rdTypeFile
+		if n.dir {
+			t = rdTypeDir
+		}
+		nextBlock((9 + len(child) + 1 + 3) &^ 3)
+		header(t, n.modTime, len(n.data))
+		buff = append(buff, child...)
+		buff = append(buff, 0)
+		pad()
+	}
+	nextBlock(9)
+	header(rdTypeEnd, time.Time{}, 0)
+	pad()
+	return
+}
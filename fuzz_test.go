@@ -0,0 +1,67 @@
+package fsp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzDecodeReply(f *testing.F) {
+	var seed, _ = EncodeReply(&Packet{Cmd: FSPCommandGetFile, Key: 0x1234, Seq: 8, Pos: 1024,
+		Data: []byte("file data"), Xtra: []byte{0, 2}})
+	f.Add(seed)
+	f.Add(make([]byte, FSPHSzie))
+	f.Fuzz(func(t *testing.T, buff []byte) {
+		var pkt fspPacket
+		p, err := DecodeReply(buff)
+		if err != nil {
+			return
+		}
+		again, err := EncodeReply(p)
+		if err != nil {
+			t.Fatalf("encode decoded packet: %v", err)
+		}
+		if !bytes.Equal(again, buff) {
+			t.Fatalf("round trip mismatch\n got %x\nwant %x", again, buff)
+		}
+		if err = pkt.read(buff); err != nil {
+			t.Fatalf("read valid packet: %v", err)
+		}
+		if int(pkt.len)+int(pkt.xlen) != len(pkt.buf) {
+			t.Fatalf("len %d + xlen %d != %d", pkt.len, pkt.xlen, len(pkt.buf))
+		}
+	})
+}
+
+func FuzzDecodeRequest(f *testing.F) {
+	var seed, _ = EncodeRequest(&Packet{Cmd: FSPCommandRename, Pos: 4, Data: []byte("a\x00"), Xtra: []byte("b\x00")})
+	f.Add(seed)
+	f.Fuzz(func(t *testing.T, buff []byte) {
+		p, err := DecodeRequest(buff)
+		if err != nil {
+			return
+		}
+		if again, _ := EncodeRequest(p); !bytes.Equal(again, buff) {
+			t.Fatalf("round trip mismatch\n got %x\nwant %x", again, buff)
+		}
+	})
+}
+
+func FuzzDirEntries(f *testing.F) {
+	// ".", "file.txt" and the end marker in one 64 byte block
+	var block = []byte{
+		0, 0, 0, 1, 0, 0, 0, 0, fspEntryTypeDir, '.', 0, 0,
+		0, 0, 0, 2, 0, 0, 0, 9, fspEntryTypeFile, 'f', 'i', 'l', 'e', '.', 't', 'x', 't', 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, fspEntryTypeEnd, 0, 0, 0,
+	}
+	f.Add(block, uint16(64))
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 0, fspEntryTypeSkip}, uint16(12))
+	f.Fuzz(func(t *testing.T, data []byte, blockSize uint16) {
+		var d = &dir{data: data, dataSize: uint(len(data)), blockSize: blockSize}
+		entrys, _ := d.ListEntrys()
+		for _, entry := range entrys {
+			if entry.Name == "" || bytes.IndexByte([]byte(entry.Name), 0) >= 0 {
+				t.Fatalf("bad entry name %q", entry.Name)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package fsp
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// HasMeta reports whether pattern contains any of the magic characters
+// recognized by Glob
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// Glob returns the names of all remote files matching pattern. The syntax is
+// the one of path.Match, in addition a "**" element matches zero or more
+// directories. FSP servers do not expand patterns, so the matching is done
+// on directory listings. I/O errors like unreadable directories are ignored,
+// the only possible returned error is path.ErrBadPattern.
+func (s *Session) Glob(pattern string) (matches []string, err error) {
+	var parts []string
+	var base string
+	var found = make(map[string]bool)
+	for _, p := range strings.Split(pattern, "/") {
+		if p == "" {
+			continue
+		}
+		if p != "**" {
+			if _, err = path.Match(p, ""); err != nil {
+				return
+			}
+		}
+		parts = append(parts, p)
+	}
+	if strings.HasPrefix(pattern, "/") {
+		base = "/"
+	}
+	s.glob(base, parts, found)
+	for name := range found {
+		matches = append(matches, name)
+	}
+	sort.Strings(matches)
+	return
+}
+
+// glob match the pattern elements in parts against the entries of dirName
+func (s *Session) glob(dirName string, parts []string, found map[string]bool) {
+	var di *dir
+	var err error
+	if len(parts) == 0 {
+		if dirName != "" {
+			found[dirName] = true
+		}
+		return
+	}
+	if !HasMeta(parts[0]) {
+		var name = path.Join(dirName, parts[0])
+		if len(parts) > 1 {
+			s.glob(name, parts[1:], found)
+		} else if _, err = s.Stat(name); err == nil {
+			found[name] = true
+		}
+		return
+	}
+	if parts[0] == "**" {
+		// match zero directory
+		s.glob(dirName, parts[1:], found)
+	}
+	di, err = s.getDir(dirName)
+	if err != nil || di == nil {
+		return
+	}
+	entrys, _ := di.ListEntrys()
+	for _, entry := range entrys {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		var name = path.Join(dirName, entry.Name)
+		if parts[0] == "**" {
+			if len(parts) == 1 {
+				found[name] = true
+			}
+			if entry.Type == fspEntryTypeDir {
+				s.glob(name, parts, found)
+			}
+			continue
+		}
+		if ok, _ := path.Match(parts[0], entry.Name); !ok {
+			continue
+		}
+		if len(parts) == 1 {
+			found[name] = true
+		} else if entry.Type == fspEntryTypeDir {
+			s.glob(name, parts[1:], found)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package fsp_test
+
+import (
+	"fmt"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestGlob(t *testing.T) {
+	var srv, s = startServer(t)
+	for _, name := range []string{"/logs/a.log", "/logs/b.txt", "/logs/2024/c.log",
+		"/logs/2024/05/d.log", "/logs/2025/e.log.gz", "/other/f.log"} {
+		srv.WriteFile(name, []byte(name), time.Now())
+	}
+	var tests = []struct {
+		pattern string
+		want    []string
+	}{
+		{"/logs/*.log", []string{"/logs/a.log"}},
+		{"/logs/*/*.log", []string{"/logs/2024/c.log"}},
+		{"/logs/**/*.log", []string{"/logs/2024/05/d.log", "/logs/2024/c.log", "/logs/a.log"}},
+		{"/*/[a-f].log", []string{"/logs/a.log", "/other/f.log"}},
+		{"/logs/b.txt", []string{"/logs/b.txt"}},
+		{"/logs/*.none", nil},
+	}
+	for _, tt := range tests {
+		got, err := s.Glob(tt.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pattern, err)
+		} else if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+	if _, err := s.Glob("/logs/[a-"); err != path.ErrBadPattern {
+		t.Errorf("bad pattern: got %v", err)
+	}
+}
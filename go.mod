@@ -1,5 +1,7 @@
 module github.com/finove/fsp
 
-go 1.13
+go 1.20
 
 require github.com/spf13/cobra v0.0.5
+
+require github.com/spf13/pflag v1.0.3 // indirect
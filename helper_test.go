@@ -0,0 +1,68 @@
+package fsp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/finove/fsp/fsptest"
+)
+
+// startServer start a fsptest server and a session connected to it, both
+// are closed when the test ends
+func startServer(t *testing.T) (srv *fsptest.Server, s *fsp.Session) {
+	var err error
+	t.Helper()
+	srv, err = fsptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = fsp.NewSession(srv.Addr, "")
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		srv.Close()
+	})
+	return
+}
+
+// pipeSession return a session whose requests are answered by reply through
+// a pipe transport, for replies the fsptest server never sends. A nil reply
+// is not sent, like a server ignoring the request.
+func pipeSession(t *testing.T, reply func(req *fsp.Packet) *fsp.Packet) (s *fsp.Session) {
+	var err error
+	var client, server = fsp.NewPipe()
+	t.Helper()
+	go func() {
+		var buff = make([]byte, fsp.FSPMaxPacket)
+		for {
+			n, err := server.Receive(buff, time.Time{})
+			if err != nil {
+				return
+			}
+			req, err := fsp.DecodeRequest(buff[:n])
+			if err != nil {
+				continue
+			}
+			var p = reply(req)
+			if p == nil {
+				continue
+			}
+			p.Key, p.Seq = req.Key, req.Seq
+			out, _ := fsp.EncodeReply(p)
+			server.Send(out)
+		}
+	}()
+	s, err = fsp.NewSessionWithTransport(client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		server.Close()
+	})
+	return
+}
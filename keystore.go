@@ -0,0 +1,60 @@
+package fsp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// KeyStore keeps the KEY of the client host. The server uses one KEY per
+// client network address, so sessions talking to the same server at the
+// same time must share one store: Acquire blocks until no other transaction
+// is in flight and returns the key to send, Release stores the key of the
+// server reply and lets the next transaction go.
+type KeyStore interface {
+	Acquire() (key uint16)
+	Release(key uint16)
+}
+
+// fileKeyStore key store saved in a temporary file between runs
+type fileKeyStore struct {
+	mu   sync.Mutex
+	path string
+	lock string
+}
+
+func newFileKeyStore() (k *fileKeyStore, err error) {
+	var buff []byte
+	k = &fileKeyStore{
+		path: filepath.Join(os.TempDir(), fmt.Sprintf("FSP%s", "1")),
+		lock: "13579",
+	}
+	buff, err = ioutil.ReadFile(k.path)
+	if err == nil {
+		k.lock = string(buff)
+	}
+	return
+}
+
+// Acquire lock the store and return current key
+func (k *fileKeyStore) Acquire() (key uint16) {
+	k.mu.Lock()
+	v, _ := strconv.Atoi(k.lock)
+	key = uint16(v)
+	return
+}
+
+// Release save the new key and unlock the store
+func (k *fileKeyStore) Release(key uint16) {
+	k.lock = fmt.Sprintf("%d", key)
+	k.mu.Unlock()
+}
+
+func (k *fileKeyStore) save() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	ioutil.WriteFile(k.path, []byte(k.lock), os.ModePerm)
+}
@@ -0,0 +1,18 @@
+package fsp
+
+import "fmt"
+
+// maxFilePos is the first byte a 32 bit FILE_POSITION can not address.
+// FSP v2 has no documented way to go beyond it, transfers that would
+// overflow the position stop with ErrTooLarge instead of wrapping.
+const maxFilePos = int64(1) << 32
+
+// seek set the packet position for transferring n bytes at f.pos
+func (f *File) seek(n int) (err error) {
+	if f.pos+int64(n) > maxFilePos {
+		err = newKindError(ErrTooLarge, fmt.Sprintf("%s is larger than 4 GiB, FSP positions are 32 bit", f.name))
+		return
+	}
+	f.out.pos = uint32(f.pos)
+	return
+}
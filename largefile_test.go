@@ -0,0 +1,48 @@
+package fsp_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestReadBeyond4GiB(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.WriteFile("/big.bin", testData(100), time.Now())
+	f, err := fsp.OpenFile(s, "/big.bin", "rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SeekTo(1 << 32); err != nil {
+		t.Fatal(err)
+	}
+	var buff = make([]byte, fsp.FSPSpace)
+	var requests = srv.Requests()
+	_, err = f.Read(buff, 1, 1)
+	if !errors.Is(err, fsp.ErrTooLarge) {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+	if srv.Requests() != requests {
+		t.Error("request with wrapped position sent")
+	}
+}
+
+func TestWriteBeyond4GiB(t *testing.T) {
+	var _, s = startServer(t)
+	f, err := fsp.OpenFile(s, "/big.bin", "wb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SeekTo(1<<32 - 100); err != nil {
+		t.Fatal(err)
+	}
+	err = f.Write(testData(3000))
+	if err == nil {
+		err = f.Flush()
+	}
+	if !errors.Is(err, fsp.ErrTooLarge) {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+}
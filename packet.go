@@ -70,9 +70,51 @@ type fspPacket struct {
 	buf  []byte // packet payload
 }
 
-// read 解析收到的FSP包
-func (pkt *fspPacket) read(buff []byte) (err error) {
-	var mySum int
+// Packet is a FSP v2 packet as sent on the wire
+type Packet struct {
+	Cmd  uint8  // FSP_COMMAND
+	Key  uint16 // message KEY
+	Seq  uint16 // message SEQUENCE
+	Pos  uint32 // FILE_POSITION
+	Data []byte // DATA, its length is DATA_LENGTH
+	Xtra []byte // XTRA DATA
+}
+
+// checksum of the packet with the checksum field as zero. Packets from
+// client start the sum with the packet size, packets from server with zero.
+func checksum(buff []byte, fromClient bool) uint8 {
+	var sum int
+	if fromClient {
+		sum = len(buff)
+	}
+	for i, b := range buff {
+		if i != fspOffsetSum {
+			sum += int(b)
+		}
+	}
+	return uint8(sum + (sum >> 8))
+}
+
+func encodePacket(p *Packet, fromClient bool) (buff []byte, err error) {
+	if len(p.Data)+len(p.Xtra) > FSPSpace {
+		err = newOpError("packet payload too big")
+		return
+	}
+	buff = make([]byte, FSPHSzie, FSPHSzie+len(p.Data)+len(p.Xtra))
+	buff[fspOffsetCmd] = p.Cmd
+	binary.BigEndian.PutUint16(buff[fspOffsetKey:], p.Key)
+	binary.BigEndian.PutUint16(buff[fspOffsetSeq:], p.Seq)
+	binary.BigEndian.PutUint16(buff[fspOffsetLen:], uint16(len(p.Data)))
+	binary.BigEndian.PutUint32(buff[fspOffsetPos:], p.Pos)
+	buff = append(buff, p.Data...)
+	buff = append(buff, p.Xtra...)
+	buff[fspOffsetSum] = checksum(buff, fromClient)
+	return
+}
+
+func decodePacket(buff []byte, fromClient bool) (p *Packet, err error) {
+	var sum uint8
+	var dataLen int
 	if len(buff) < FSPHSzie {
 		err = newOpError("recv packet too short")
 		return
@@ -81,35 +123,69 @@ func (pkt *fspPacket) read(buff []byte) (err error) {
 		err = newOpError("recv packet too long")
 		return
 	}
-	for _, b := range buff {
-		mySum += int(b)
-	}
-	mySum -= int(buff[fspOffsetSum])
-	mySum = (mySum + (mySum >> 8)) & 0xff
-	if mySum != int(buff[fspOffsetSum]) {
-		err = newOpError(fmt.Sprintf("checksum fail, mySum %x, got %x", mySum, buff[fspOffsetSum]))
+	sum = checksum(buff, fromClient)
+	if sum != buff[fspOffsetSum] {
+		err = newKindError(ErrChecksum, fmt.Sprintf("checksum fail, mySum %x, got %x", sum, buff[fspOffsetSum]))
 		return
 	}
-	pkt.cmd = buff[fspOffsetCmd]
-	pkt.sum = uint8(mySum)
-	pkt.key = binary.BigEndian.Uint16(buff[fspOffsetKey:])
-	pkt.seq = binary.BigEndian.Uint16(buff[fspOffsetSeq:])
-	pkt.len = binary.BigEndian.Uint16(buff[fspOffsetLen:])
-	pkt.pos = binary.BigEndian.Uint32(buff[fspOffsetPos:])
-	if (int(pkt.len) + FSPHSzie) > len(buff) {
+	dataLen = int(binary.BigEndian.Uint16(buff[fspOffsetLen:]))
+	if dataLen+FSPHSzie > len(buff) {
 		err = newOpError("fsp packet length field invalid")
 		return
 	}
-	pkt.xlen = uint16(len(buff)) - pkt.len - FSPHSzie
-	pkt.buf = make([]byte, len(buff)-FSPHSzie)
-	copy(pkt.buf, buff[FSPHSzie:])
+	p = &Packet{
+		Cmd:  buff[fspOffsetCmd],
+		Key:  binary.BigEndian.Uint16(buff[fspOffsetKey:]),
+		Seq:  binary.BigEndian.Uint16(buff[fspOffsetSeq:]),
+		Pos:  binary.BigEndian.Uint32(buff[fspOffsetPos:]),
+		Data: append([]byte(nil), buff[FSPHSzie:FSPHSzie+dataLen]...),
+		Xtra: append([]byte(nil), buff[FSPHSzie+dataLen:]...),
+	}
+	return
+}
+
+// EncodeRequest encode a packet sent by client
+func EncodeRequest(p *Packet) ([]byte, error) {
+	return encodePacket(p, true)
+}
+
+// DecodeRequest decode and validate a packet sent by client
+func DecodeRequest(buff []byte) (*Packet, error) {
+	return decodePacket(buff, true)
+}
+
+// EncodeReply encode a packet sent by server
+func EncodeReply(p *Packet) ([]byte, error) {
+	return encodePacket(p, false)
+}
+
+// DecodeReply decode and validate a packet sent by server
+func DecodeReply(buff []byte) (*Packet, error) {
+	return decodePacket(buff, false)
+}
+
+// read 解析收到的FSP包
+func (pkt *fspPacket) read(buff []byte) (err error) {
+	var p *Packet
+	p, err = DecodeReply(buff)
+	if err != nil {
+		return
+	}
+	pkt.cmd = p.Cmd
+	pkt.sum = buff[fspOffsetSum]
+	pkt.key = p.Key
+	pkt.seq = p.Seq
+	pkt.len = uint16(len(p.Data))
+	pkt.pos = p.Pos
+	pkt.xlen = uint16(len(p.Xtra))
+	pkt.buf = append(p.Data, p.Xtra...)
 	return
 }
 
 // buildFileName set fileName and password
 func (pkt *fspPacket) buildFileName(fileName, password string) (err error) {
 	if (len(fileName) + len(password) + 2) >= FSPSpace {
-		err = newOpError("file name too long")
+		err = newKindError(ErrNameTooLong, "file name too long")
 		return
 	}
 	pkt.buf = append(pkt.buf, fileName[:]...)
@@ -126,42 +202,37 @@ func (pkt *fspPacket) buildFileName(fileName, password string) (err error) {
 }
 
 func (pkt *fspPacket) write(s *Session) (err error) {
-	var checksum = 0
-	var used int
-	var sendBuff = make([]byte, FSPHSzie)
-	if pkt.xlen+pkt.len > FSPSpace {
+	var p Packet
+	var sendBuff []byte
+	if pkt.xlen+pkt.len > FSPSpace || int(pkt.len) > len(pkt.buf) {
 		err = newOpError("packet payload too big")
 		return
 	}
-	sendBuff[fspOffsetCmd] = pkt.cmd
-	sendBuff[fspOffsetSum] = 0
-	binary.BigEndian.PutUint16(sendBuff[fspOffsetKey:], pkt.key)
-	binary.BigEndian.PutUint16(sendBuff[fspOffsetSeq:], pkt.seq)
-	binary.BigEndian.PutUint16(sendBuff[fspOffsetLen:], pkt.len)
-	binary.BigEndian.PutUint32(sendBuff[fspOffsetPos:], pkt.pos)
-	used = FSPHSzie
-	sendBuff = append(sendBuff, pkt.buf[:pkt.len]...)
-	used += int(pkt.len)
-
+	p.Cmd = pkt.cmd
+	p.Key = pkt.key
+	p.Seq = pkt.seq
+	p.Pos = pkt.pos
+	p.Data = pkt.buf[:pkt.len]
 	if pkt.cmd == FSPCommandGetFile {
 		// for dynamically adjusting the pkt size to adjust speed of transction
 		if pkt.xlen == 2 {
-			sendBuff = append(sendBuff, []byte{0, 0}...)
-			binary.BigEndian.PutUint16(sendBuff[used:], s.trans.pktSize)
-			used += int(pkt.xlen)
+			p.Xtra = make([]byte, 2)
+			binary.BigEndian.PutUint16(p.Xtra, s.trans.pktSize)
 		}
 	} else if pkt.xlen > 0 {
-		sendBuff = append(sendBuff, pkt.buf[pkt.len:pkt.len+pkt.xlen]...)
-		used += int(pkt.xlen)
+		if int(pkt.len+pkt.xlen) > len(pkt.buf) {
+			err = newOpError("packet extra data too short")
+			return
+		}
+		p.Xtra = pkt.buf[pkt.len : pkt.len+pkt.xlen]
 	}
-	for _, b := range sendBuff[:used] {
-		checksum += int(b)
+	sendBuff, err = EncodeRequest(&p)
+	if err != nil {
+		return
 	}
-	checksum += used
-	sendBuff[fspOffsetSum] = uint8(checksum + (checksum >> 8))
-	_, err = s.conn.WriteToUDP(sendBuff[:used], s.serverAddr)
+	err = s.tr.Send(sendBuff)
 	if err != nil {
-		err = newOpError(err.Error())
+		err = &fspError{Err: err}
 	}
 	return
 }
@@ -0,0 +1,125 @@
+package fsp
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting transfer speed, it can be shared
+// by several sessions and files to cap their sum
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, 0 is unlimited
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter return a limiter of bytesPerSec, 0 is unlimited
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	var r = &RateLimiter{}
+	r.SetRate(bytesPerSec)
+	return r
+}
+
+// SetRate change the limit, 0 is unlimited
+func (r *RateLimiter) SetRate(bytesPerSec int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	r.rate = float64(bytesPerSec)
+	r.tokens = 0
+	r.last = time.Now()
+}
+
+// Rate return the limit in bytes per second, 0 is unlimited
+func (r *RateLimiter) Rate() int64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(r.rate)
+}
+
+// Wait block until n bytes may be transferred
+func (r *RateLimiter) Wait(n int) {
+	var delay time.Duration
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.rate > 0 {
+		var now = time.Now()
+		// bucket holds at most one second of traffic
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.rate {
+			r.tokens = r.rate
+		}
+		r.last = now
+		r.tokens -= float64(n)
+		if r.tokens < 0 {
+			delay = time.Duration(-r.tokens / r.rate * float64(time.Second))
+		}
+	}
+	r.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// SetRateLimit limit the transfer speed of session in bytes per second, 0
+// remove the limit. When the server advertise a lower thruput in its
+// CC_VERSION reply, the server limit is used.
+func (s *Session) SetRateLimit(bytesPerSec int64) {
+	s.userRate = bytesPerSec
+	s.applyRate()
+}
+
+// applyRate set the session limiter to the lower of user and server limit
+func (s *Session) applyRate() {
+	var rate = s.userRate
+	if s.serverRate > 0 && (rate == 0 || s.serverRate < rate) {
+		rate = s.serverRate
+	}
+	s.limit.SetRate(rate)
+	s.trans.capPacket(rate)
+}
+
+// serverProbeTimeout limit the CC_VERSION query of SetServerRateProbe
+const serverProbeTimeout = 2 * time.Second
+
+// SetServerRateProbe query the server thruput limit with CC_VERSION before
+// the first transfer. It is off by default because some servers never
+// answer CC_VERSION and each session would wait 2 seconds for them, without
+// it the server limit is applied once ServerInfo got a reply.
+func (s *Session) SetServerRateProbe(probe bool) {
+	s.rateProbe = probe
+}
+
+// loadServerRate query the server thruput limit once before the first
+// transfer when SetServerRateProbe is on
+func (s *Session) loadServerRate() {
+	if !s.rateProbe || s.rateChecked {
+		return
+	}
+	s.rateChecked = true
+	s.serverInfo(serverProbeTimeout)
+}
+
+// SetRateLimit limit the speed of this file transfer in bytes per second,
+// on top of the session limit, 0 remove the limit
+func (f *File) SetRateLimit(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		f.limit = nil
+		return
+	}
+	f.limit = NewRateLimiter(bytesPerSec)
+}
+
+// wait for both the file and the session limiter
+func (f *File) wait(n int) {
+	f.limit.Wait(n)
+	f.s.limit.Wait(n)
+}
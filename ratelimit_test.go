@@ -0,0 +1,126 @@
+package fsp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var r = fsp.NewRateLimiter(10000)
+	var start = time.Now()
+	for i := 0; i < 5; i++ {
+		r.Wait(1000)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond || d > time.Second {
+		t.Errorf("5000 bytes at 10000 B/s took %v", d)
+	}
+	r.SetRate(0)
+	start = time.Now()
+	r.Wait(1 << 30)
+	if d := time.Since(start); d > 10*time.Millisecond {
+		t.Errorf("unlimited wait took %v", d)
+	}
+}
+
+// timedDownload return the duration of downloading name and check its data
+func timedDownload(t *testing.T, s *fsp.Session, name string, data []byte) time.Duration {
+	var buff bytes.Buffer
+	var start = time.Now()
+	if _, err := s.Download(context.Background(), name, &buff); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buff.Bytes(), data) {
+		t.Fatalf("got %d bytes, want %d", buff.Len(), len(data))
+	}
+	return time.Since(start)
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(8000)
+	srv.WriteFile("/limited.bin", data, time.Now())
+	s.SetRateLimit(4000)
+	if d := timedDownload(t, s, "/limited.bin", data); d < 1500*time.Millisecond {
+		t.Errorf("8000 bytes at 4000 B/s took %v", d)
+	}
+}
+
+func TestServerThruputLimit(t *testing.T) {
+	var data = testData(8000)
+	for _, tt := range []struct {
+		name    string
+		setup   func(s *fsp.Session)
+		limited bool
+	}{
+		{"no probe", func(s *fsp.Session) {}, false},
+		{"probe", func(s *fsp.Session) { s.SetServerRateProbe(true) }, true},
+		{"server info", func(s *fsp.Session) { s.ServerInfo() }, true},
+	} {
+		var srv, s = startServer(t)
+		srv.WriteFile("/limited.bin", data, time.Now())
+		srv.SetVersion("slow", fsp.FSPServerThruput, 4000, 0)
+		tt.setup(s)
+		var d = timedDownload(t, s, "/limited.bin", data)
+		if tt.limited && d < 1500*time.Millisecond {
+			t.Errorf("%s: 8000 bytes at server limit 4000 B/s took %v", tt.name, d)
+		} else if !tt.limited && d > time.Second {
+			t.Errorf("%s: unlimited download took %v", tt.name, d)
+		}
+	}
+}
+
+func TestServerRateProbeHidden(t *testing.T) {
+	var versions int
+	var s = pipeSession(t, func(req *fsp.Packet) *fsp.Packet {
+		switch req.Cmd {
+		case fsp.FSPCommandVersion:
+			// hide from scanners
+			versions++
+			return nil
+		case fsp.FSPCommandStat:
+			return &fsp.Packet{Cmd: req.Cmd, Data: []byte{0, 0, 0, 1, 0, 0, 0, 2, 1}}
+		case fsp.FSPCommandGetFile:
+			if req.Pos == 0 {
+				return &fsp.Packet{Cmd: req.Cmd, Data: []byte("ok")}
+			}
+		}
+		return &fsp.Packet{Cmd: req.Cmd, Pos: req.Pos}
+	})
+	var start = time.Now()
+	timedDownload(t, s, "/f", []byte("ok"))
+	if d := time.Since(start); d > time.Second || versions != 0 {
+		t.Errorf("without probe took %v and sent %d CC_VERSION", d, versions)
+	}
+	s.SetServerRateProbe(true)
+	start = time.Now()
+	timedDownload(t, s, "/f", []byte("ok"))
+	timedDownload(t, s, "/f", []byte("ok"))
+	if d := time.Since(start); d < 1900*time.Millisecond || d > 3*time.Second {
+		t.Errorf("probe of a hidden server took %v, want 2s once", d)
+	}
+}
+
+func TestTailRateLimit(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(8000)
+	srv.WriteFile("/limited.bin", data, time.Now())
+	s.SetRateLimit(4000)
+	tail, err := s.Tail("/limited.bin", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail.Follow = false
+	var start = time.Now()
+	got, err := io.ReadAll(tail)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+	if d := time.Since(start); d < 1500*time.Millisecond {
+		t.Errorf("8000 bytes at 4000 B/s took %v", d)
+	}
+}
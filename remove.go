@@ -0,0 +1,139 @@
+package fsp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// RemoveOptions options of RemoveTree
+type RemoveOptions struct {
+	DryRun bool // only report what would be removed
+}
+
+// RemoveResult outcome of removing one entry
+type RemoveResult struct {
+	Path string
+	Dir  bool
+	Err  error // nil when removed, or would be removed on dry run
+}
+
+// RemoveReport outcome of RemoveTree, entries are in removal order
+type RemoveReport struct {
+	Results []RemoveResult
+	Removed int // entries removed, or would be removed on dry run
+	Failed  int // entries not removed
+}
+
+// Err return nil when every entry was removed, otherwise an error listing
+// the failed entries
+func (r *RemoveReport) Err() error {
+	if r == nil || r.Failed == 0 {
+		return nil
+	}
+	var msg = fmt.Sprintf("%d of %d entries not removed", r.Failed, len(r.Results))
+	for _, res := range r.Results {
+		if res.Err != nil {
+			msg += fmt.Sprintf("; %s: %v", res.Path, res.Err)
+		}
+	}
+	return newOpError(msg)
+}
+
+// RemoveDir delete an empty directory
+func (s *Session) RemoveDir(name string) (err error) {
+	s.cache.invalidate(name)
+	return s.simpleCommand(name, FSPCommandDelDir)
+}
+
+// RemoveAll delete name and everything it contains like os.RemoveAll, it
+// return nil when name does not exist. See RemoveTree for the details of
+// partial failures.
+func (s *Session) RemoveAll(name string) (err error) {
+	var report *RemoveReport
+	report, err = s.RemoveTree(name, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err == nil {
+		err = report.Err()
+	}
+	return
+}
+
+// RemoveTree delete root and everything below it, files first and then the
+// directories bottom-up. Entries in directories without delete right, see
+// GetProtecion, are not tried and reported as ErrPermission; directories
+// keeping such entries are reported as not empty. One failure does not stop
+// the removal of the other entries. err is only set when root can not be
+// read, the outcome of each entry is in report.
+func (s *Session) RemoveTree(root string, opts *RemoveOptions) (report *RemoveReport, err error) {
+	var results []RemoveResult
+	var canDelete = make(map[string]bool)
+	var kept = make(map[string]bool) // directories keeping entries
+	if opts == nil {
+		opts = &RemoveOptions{}
+	}
+	err = s.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil {
+				return err
+			}
+			// not listed, so it can not be emptied
+			results[len(results)-1].Err = err
+			return fs.SkipDir
+		}
+		results = append(results, RemoveResult{Path: name, Dir: d.IsDir()})
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	report = &RemoveReport{}
+	for i := len(results) - 1; i >= 0; i-- {
+		var res = results[i]
+		var parent = path.Dir(cleanPath(res.Path))
+		switch {
+		case res.Err != nil:
+			// keep the listing error
+		case res.Dir && kept[cleanPath(res.Path)]:
+			res.Err = newOpError("directory not empty")
+		case !s.deleteAllowed(parent, canDelete):
+			res.Err = newKindError(ErrPermission, "no delete right in "+parent)
+		case opts.DryRun:
+		case res.Dir:
+			res.Err = s.RemoveDir(res.Path)
+		default:
+			res.Err = s.Remove(res.Path)
+		}
+		if res.Err != nil {
+			report.Failed++
+			for dir := parent; ; dir = path.Dir(dir) {
+				kept[dir] = true
+				if dir == "/" || !strings.HasPrefix(dir, cleanPath(root)) {
+					break
+				}
+			}
+		} else {
+			report.Removed++
+		}
+		report.Results = append(report.Results, res)
+	}
+	return
+}
+
+// deleteAllowed report whether entries of dirName can be deleted, servers
+// not answering CC_GET_PRO are assumed to allow it
+func (s *Session) deleteAllowed(dirName string, known map[string]bool) bool {
+	if allowed, ok := known[dirName]; ok {
+		return allowed
+	}
+	var allowed = true
+	if protection, err := s.GetProtecion(dirName); err == nil {
+		allowed = protection&(FSPDirOwner|FSPDirDel) != 0
+	}
+	known[dirName] = allowed
+	return allowed
+}
@@ -0,0 +1,76 @@
+package fsp_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/finove/fsp/fsptest"
+)
+
+// removeTree create /r with files and a subdirectory
+func removeTree(srv *fsptest.Server) {
+	for _, name := range []string{"/r/a.txt", "/r/sub/b.txt", "/r/sub/c.txt"} {
+		srv.WriteFile(name, []byte(name), time.Now())
+	}
+}
+
+func TestRemoveTreeDryRun(t *testing.T) {
+	var srv, s = startServer(t)
+	removeTree(srv)
+	report, err := s.RemoveTree("/r", &fsp.RemoveOptions{DryRun: true})
+	if err != nil || report.Err() != nil {
+		t.Fatal(err, report.Err())
+	}
+	var names []string
+	for _, res := range report.Results {
+		names = append(names, res.Path)
+	}
+	if got := strings.Join(names, " "); got != "/r/sub/c.txt /r/sub/b.txt /r/sub /r/a.txt /r" {
+		t.Errorf("got removal order %s", got)
+	}
+	if report.Removed != 5 || !srv.Exists("/r/sub/c.txt") {
+		t.Errorf("dry run removed %d, files deleted", report.Removed)
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	var srv, s = startServer(t)
+	removeTree(srv)
+	if err := s.RemoveAll("/r"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Exists("/r") {
+		t.Error("tree not removed")
+	}
+	if err := s.RemoveAll("/r"); err != nil {
+		t.Errorf("missing path: got %v", err)
+	}
+}
+
+func TestRemoveTreeProtected(t *testing.T) {
+	var srv, s = startServer(t)
+	removeTree(srv)
+	srv.SetProtection("/r/sub", fsp.FSPDirList|fsp.FSPDirGet)
+	report, err := s.RemoveTree("/r", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed = make(map[string]error)
+	for _, res := range report.Results {
+		if res.Err != nil {
+			failed[res.Path] = res.Err
+		}
+	}
+	if len(failed) != 4 || !errors.Is(failed["/r/sub/b.txt"], fsp.ErrPermission) || failed["/r"] == nil {
+		t.Errorf("got failures %v", failed)
+	}
+	if srv.Exists("/r/a.txt") || !srv.Exists("/r/sub/b.txt") {
+		t.Error("wrong entries removed")
+	}
+	if report.Err() == nil {
+		t.Error("report error is nil")
+	}
+}
@@ -1,15 +1,15 @@
 package fsp
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sync"
 	"time"
 )
 
@@ -39,6 +39,7 @@ func (t *transUnit) Speed() (speed float64) {
 type transferControl struct {
 	initial     bool
 	pktSize     uint16
+	maxPktSize  uint16 // packet size limit of rate limited session, 0 no limit
 	startTime   time.Time
 	endTime     time.Time
 	curr        transUnit
@@ -57,9 +58,30 @@ func (t *transferControl) Reset() {
 	t.circleCount = 100
 	t.circleTime = 10 * time.Second
 	t.pktSize = 768
+	if t.maxPktSize > 0 && t.pktSize > t.maxPktSize {
+		t.pktSize = t.maxPktSize
+	}
 	t.initial = true
 }
 
+// capPacket keep packets small enough for about 4 packets per second on
+// rate limited transfers
+func (t *transferControl) capPacket(rate int64) {
+	t.maxPktSize = 0
+	if rate > 0 {
+		t.maxPktSize = uint16(rate / 4)
+		if rate/4 > FSPSpace {
+			t.maxPktSize = FSPSpace
+		}
+		if t.maxPktSize < 64 {
+			t.maxPktSize = 64
+		}
+	}
+	if t.maxPktSize > 0 && t.pktSize > t.maxPktSize {
+		t.pktSize = t.maxPktSize
+	}
+}
+
 func (t *transferControl) Percent() (percent int64) {
 	if t.totalSize > 0 {
 		percent = t.doneSize * 100 / t.totalSize
@@ -84,20 +106,31 @@ func (t *transferControl) updateUnit(retry uint16, rcevLen int64) {
 
 // Session fsp session
 type Session struct {
-	conn       *net.UDPConn
-	serverAddr *net.UDPAddr
-	password   string
-	lock       string
-	lockFile   string
-	timeOut    uint
-	maxDelay   uint
-	trans      transferControl
-	seq        uint16 // sequence number
-	dupes      uint   // total pkt. dupes
-	resends    uint   // total pkt. sends
-	trips      uint   // total pkt. trips
-	rtts       uint32 // cumul. rtt
-	verboseLvl int    // verbose level
+	tr          Transport
+	serverAddr  *net.UDPAddr // nil if transport is not UDP
+	password    string
+	keys        KeyStore
+	mu          sync.Mutex // one transaction at a time
+	timeOut     uint
+	maxDelay    uint
+	trans       transferControl
+	seq         uint16       // sequence number
+	dupes       uint         // total pkt. dupes
+	resends     uint         // total pkt. sends
+	trips       uint         // total pkt. trips
+	rtts        uint32       // cumul. rtt
+	verboseLvl  int          // verbose level
+	verify      Verify       // checks after download
+	keepTimes   bool         // set local mtime from remote file
+	skipSame    bool         // skip download of unchanged files
+	limit       *RateLimiter // shared with forked sessions
+	userRate    int64        // limit set by SetRateLimit
+	serverRate  int64        // limit advertised by server
+	rateProbe   bool         // query server limit before the first transfer
+	rateChecked bool         // server limit queried
+	atomic      bool         // UploadFile use a temporary name
+	cache       *dirCache    // shared with forked sessions
+	walkWorkers int          // sessions listing directories in WalkDir
 }
 
 // startDownload set total download size
@@ -113,10 +146,28 @@ func (s *Session) finishDownload() {
 
 // transaction make one send + receive transaction with server
 func (s *Session) transaction(pkt *fspPacket) (resp fspPacket, err error) {
+	return s.transactionWithin(pkt, 0)
+}
+
+// transactionWithin make one transaction giving up after limit, 0 use the
+// session timeout
+func (s *Session) transactionWithin(pkt *fspPacket, limit time.Duration) (resp fspPacket, err error) {
 	var retry uint16
 	var firstSend = time.Now()
 	var delay = time.Duration(1340) * time.Millisecond
-	pkt.key = s.clientGetKey()
+	var nextKey uint16
+	var until time.Time
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 {
+		limit = time.Duration(s.timeOut) * time.Second
+	}
+	until = firstSend.Add(limit)
+	pkt.key = s.keys.Acquire()
+	nextKey = pkt.key
+	defer func() {
+		s.keys.Release(nextKey)
+	}()
 	retry = s.randUint16() & 0xfff8
 	if s.seq == retry {
 		s.seq ^= 0x1080
@@ -125,8 +176,8 @@ func (s *Session) transaction(pkt *fspPacket) (resp fspPacket, err error) {
 	}
 	retry = 0
 	for ; ; retry++ {
-		if time.Since(firstSend) > time.Duration(s.timeOut)*time.Second {
-			err = newOpError("transaction timeout")
+		if !time.Now().Before(until) {
+			err = newKindError(ErrTimeout, "transaction timeout")
 			break
 		}
 		pkt.seq = s.seq | (retry & 0x7)
@@ -145,11 +196,13 @@ func (s *Session) transaction(pkt *fspPacket) (resp fspPacket, err error) {
 		for {
 			var n int
 			var buff []byte
+			var wait = time.Now().Add(delay)
+			if wait.After(until) {
+				wait = until
+			}
 			buff = make([]byte, FSPMaxPacket)
-			s.conn.SetReadDeadline(time.Now().Add(delay))
-			n, err = s.conn.Read(buff)
+			n, err = s.tr.Receive(buff, wait)
 			if err != nil || n <= 0 {
-				s.clientSetKey(pkt.key)
 				break
 			}
 			err = resp.read(buff[:n])
@@ -165,19 +218,19 @@ func (s *Session) transaction(pkt *fspPacket) (resp fspPacket, err error) {
 				s.dupes++
 				continue
 			}
-			// check correct filepos
-			if resp.pos != pkt.pos && (pkt.cmd == FSPCommandGetDir || pkt.cmd == FSPCommandGetFile ||
+			// check correct filepos, position of CC_ERR is its xtra data size
+			if resp.pos != pkt.pos && resp.cmd != FSPCommandErr && (pkt.cmd == FSPCommandGetDir || pkt.cmd == FSPCommandGetFile ||
 				pkt.cmd == FSPCommandUpload || pkt.cmd == FSPCommandGrabFile || pkt.cmd == FSPCommandInfo) {
 				s.dupes++
 				continue
 			}
 			if resp.cmd == FSPCommandErr {
 				// fmt.Printf("Failed, code=%d,reason=\"%s\"\n", FSPCommandErr, resp.buf)
-				err = &fspError{Cmd: resp.cmd, Reason: string(resp.buf)}
+				err = newServerError(&resp)
 			} else if resp.cmd == FSPCommandGetFile {
 				s.trans.updateUnit(retry, int64(resp.len))
 			}
-			s.clientSetKey(resp.key)
+			nextKey = resp.key
 			return
 		}
 	}
@@ -204,6 +257,11 @@ func (s *Session) simpleCommand(directory string, command uint8) (err error) {
 func (s *Session) setDefault() {
 	s.timeOut = 10
 	s.maxDelay = 2
+	s.verify = VerifyDefault
+	s.keepTimes = true
+	s.limit = NewRateLimiter(0)
+	s.cache = &dirCache{}
+	s.trans.Reset()
 	s.seq = s.randUint16() & 0xfff8
 }
 
@@ -214,30 +272,62 @@ func (s *Session) verbose(level int, format string, v ...interface{}) {
 }
 
 func (s *Session) loadKey() {
-	s.lockFile = filepath.Join(os.TempDir(), fmt.Sprintf("FSP%s", "1"))
-	buff, err := ioutil.ReadFile(s.lockFile)
+	var k *fileKeyStore
+	var err error
+	k, err = newFileKeyStore()
 	if err != nil {
-		s.lock = "13579"
 		s.verbose(1, "loadKey fail %v", err)
-		return
+	} else {
+		s.verbose(1, "loadKey %s from %s", k.lock, k.path)
 	}
-	s.lock = string(buff)
-	s.verbose(1, "loadKey %s from %s", s.lock, s.lockFile)
-	return
+	s.keys = k
 }
 
 func (s *Session) saveKey() {
-	ioutil.WriteFile(s.lockFile, []byte(s.lock), os.ModePerm)
+	if k, ok := s.keys.(*fileKeyStore); ok {
+		k.save()
+	}
 }
 
-func (s *Session) clientGetKey() (key uint16) {
-	v, _ := strconv.Atoi(s.lock)
-	key = uint16(v)
-	return
+// KeyStore return the key store used by session
+func (s *Session) KeyStore() KeyStore {
+	return s.keys
 }
 
-func (s *Session) clientSetKey(key uint16) {
-	s.lock = fmt.Sprintf("%d", key)
+// SetKeyStore share key store with other sessions to the same server, see KeyStore
+func (s *Session) SetKeyStore(keys KeyStore) {
+	if keys != nil {
+		s.keys = keys
+	}
+}
+
+// fork open another session to the same server on a new local port, the key
+// store is shared with s
+func (s *Session) fork() (session *Session, err error) {
+	var conn *net.UDPConn
+	if s.serverAddr == nil {
+		err = newOpError("only udp session can open more sessions")
+		return
+	}
+	conn, err = net.ListenUDP(udpNetwork(s.serverAddr.IP), nil)
+	if err != nil {
+		return
+	}
+	session, err = NewSessionWithConn(conn, s.serverAddr.String(), s.password)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	session.keys = s.keys
+	session.verboseLvl = s.verboseLvl
+	session.limit = s.limit
+	session.userRate = s.userRate
+	session.serverRate = s.serverRate
+	session.rateProbe = s.rateProbe
+	session.rateChecked = s.rateChecked
+	session.cache = s.cache
+	session.trans.capPacket(s.limit.Rate())
+	return
 }
 
 func (s *Session) randUint16() uint16 {
@@ -265,6 +355,9 @@ func (s *Session) getDir(dirName string) (di *dir, err error) {
 	if dirName == "" {
 		dirName = "/"
 	}
+	if di = s.cachedDir(dirName); di != nil {
+		return
+	}
 	err = p.buildFileName(dirName, s.password)
 	if err != nil {
 		return
@@ -287,7 +380,7 @@ func (s *Session) getDir(dirName string) (di *dir, err error) {
 		if di.blockSize == 0 {
 			di.blockSize = resp.len
 		}
-		di.data = append(di.data, resp.buf...)
+		di.data = append(di.data, resp.buf[:resp.len]...)
 		pos += uint32(resp.len)
 		if resp.len < di.blockSize {
 			break
@@ -300,6 +393,8 @@ func (s *Session) getDir(dirName string) (di *dir, err error) {
 		di.inUse = 1
 		di.dirName = dirName
 		di.dataSize = uint(pos)
+		var cached = *di
+		s.cache.put(cacheDir, dirName, &cached)
 	} else {
 		err = newOpError(fmt.Sprintf("read dir %s fail", dirName))
 		di = nil
@@ -313,6 +408,7 @@ func (s *Session) openFile(remoteFile, mode string) (fspFile *File, err error) {
 		err = newOpError("invald param for open fsp file")
 		return
 	}
+	s.loadServerRate()
 	fspFile = &File{
 		writing: false,
 		s:       s,
@@ -353,24 +449,21 @@ func (s *Session) openFile(remoteFile, mode string) (fspFile *File, err error) {
 // getFile download file from fsp server
 func (s *Session) getFile(remotePath, savePath string, retry int) (err error) {
 	var fp *os.File
-	var fileName = filepath.Base(remotePath)
 	var saveFile string
-	var fspFile *File
-	var buff []byte
-	var done int
-	if savePath == "" {
-		saveFile = fileName
-	} else if len(savePath) > 0 && os.IsPathSeparator(savePath[len(savePath)-1]) {
-		saveFile = filepath.Join(savePath, fileName)
-	} else {
-		saveFile = savePath
-	}
+	var before os.FileInfo
+	saveFile = saveFileName(remotePath, savePath)
 	err = os.MkdirAll(filepath.Dir(saveFile), os.ModePerm)
 	if err != nil {
 		err = newOpError(fmt.Sprintf("create save directory fail, %v", err))
 		s.verbose(1, "create save directory fail, %v", err)
 		return
 	}
+	if s.verify != 0 || s.keepTimes {
+		before, err = s.Stat(remotePath)
+		if err != nil {
+			return
+		}
+	}
 TRYAGAIN:
 	fp, err = os.Create(saveFile)
 	if err != nil {
@@ -378,28 +471,37 @@ TRYAGAIN:
 		s.verbose(1, "create file %s fail, %v", saveFile, err)
 		return
 	}
-	defer fp.Close()
-	fspFile, err = s.openFile(remotePath, "rb")
-	if err != nil || fspFile == nil {
-		s.verbose(1, "open fsp file fail, err %v", err)
-		return
-	}
-	buff = make([]byte, FSPSpace)
-	for {
-		done, err = fspFile.Read(buff, 1, 1024)
-		if err != nil {
-			break
-		}
-		if done > 0 {
-			fp.Write(buff[:done])
-		} else {
-			break
-		}
-	}
-	fspFile.Close()
+	_, err = s.download(context.Background(), remotePath, fp, before)
+	fp.Close()
 	if op, ok := err.(Error); retry > 0 && ok && op.Timeout() == true {
 		retry--
 		goto TRYAGAIN
 	}
+	if err == nil && s.keepTimes {
+		if err = os.Chtimes(saveFile, before.ModTime(), before.ModTime()); err != nil {
+			err = newOpError(fmt.Sprintf("set time of %s fail, %v", saveFile, err))
+		}
+	}
 	return
 }
+
+// saveFileName local path of remotePath saved as savePath, an empty savePath
+// or one ending with separator get the base name of remote file
+func saveFileName(remotePath, savePath string) string {
+	var fileName = filepath.Base(remotePath)
+	if savePath == "" {
+		return fileName
+	} else if os.IsPathSeparator(savePath[len(savePath)-1]) {
+		return filepath.Join(savePath, fileName)
+	}
+	return savePath
+}
+
+// unchanged check if local file has the size and mtime of remote file
+func unchanged(localPath string, remote os.FileInfo) bool {
+	var local, err = os.Stat(localPath)
+	if err != nil || !local.Mode().IsRegular() {
+		return false
+	}
+	return local.Size() == remote.Size() && local.ModTime().Unix() == remote.ModTime().Unix()
+}
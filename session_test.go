@@ -0,0 +1,206 @@
+package fsp_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/finove/fsp/fsptest"
+)
+
+// testData return n bytes of a repeating pattern
+func testData(n int) []byte {
+	var data = make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+// getBlock read name at pos with one CC_GET_FILE transaction, the session
+// choose the reply size
+func getBlock(s *fsp.Session, name string, pos uint32) ([]byte, error) {
+	var xtra = make([]byte, 2)
+	reply, err := fsp.Transaction(s, &fsp.Packet{Cmd: fsp.FSPCommandGetFile, Pos: pos,
+		Data: append([]byte(name), 0), Xtra: xtra})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Cmd != fsp.FSPCommandGetFile || reply.Pos != pos {
+		return nil, fmt.Errorf("reply cmd %#x pos %d", reply.Cmd, reply.Pos)
+	}
+	return reply.Data, nil
+}
+
+func TestTransactionFaults(t *testing.T) {
+	var data = testData(6 * 1024)
+	var tests = []struct {
+		name   string
+		faults fsptest.Faults
+		resend bool // the faults make the client resend
+	}{
+		{"loss", fsptest.Faults{Loss: 0.1, Seed: 1}, true},
+		{"duplicate", fsptest.Faults{Duplicate: 0.5, Seed: 2}, false},
+		{"reorder", fsptest.Faults{Reorder: 0.3, Seed: 1}, true},
+		{"corrupt", fsptest.Faults{Corrupt: 0.2, Seed: 4}, true},
+		{"key change", fsptest.Faults{KeyChange: true, Seed: 5}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var srv, s = startServer(t)
+			srv.WriteFile("/data.bin", data, time.Now())
+			srv.SetFaults(tt.faults)
+			var blocks int
+			var got []byte
+			var err error
+			for pos := 0; pos < len(data); pos += len(got) {
+				got, err = getBlock(s, "/data.bin", uint32(pos))
+				if err != nil {
+					t.Fatalf("pos %d: %v", pos, err)
+				}
+				if len(got) == 0 || !bytes.Equal(got, data[pos:pos+len(got)]) {
+					t.Fatalf("pos %d: wrong data", pos)
+				}
+				blocks++
+			}
+			if tt.resend && srv.Requests() <= blocks {
+				t.Errorf("%d requests for %d blocks, no fault injected", srv.Requests(), blocks)
+			}
+		})
+	}
+}
+
+func TestTransactionError(t *testing.T) {
+	var _, s = startServer(t)
+	var _, err = getBlock(s, "/missing.bin", 0)
+	if !errors.Is(err, fsp.ErrNotExist) {
+		t.Fatalf("got %v, want ErrNotExist", err)
+	}
+}
+
+func TestGetDirMultiBlock(t *testing.T) {
+	var srv, s = startServer(t)
+	var want []string
+	for i := 0; i < 100; i++ {
+		var name = fmt.Sprintf("a-rather-long-file-name-%03d.txt", i)
+		srv.WriteFile("/many/"+name, []byte(name), time.Now())
+		want = append(want, name)
+	}
+	srv.SetFaults(fsptest.Faults{Duplicate: 0.3, Seed: 1})
+	names, blockSize, err := fsp.DirEntries(s, "/many")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blockSize <= 0 || blockSize >= 100*len(want[0]) {
+		t.Errorf("block size %d, listing not split in blocks", blockSize)
+	}
+	var got []string
+	for _, name := range names {
+		if name != "." && name != ".." {
+			got = append(got, name)
+		}
+	}
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %d entries %v", len(got), got)
+	}
+}
+
+func TestFileRead(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(5000)
+	srv.WriteFile("/read.bin", data, time.Now())
+	f, err := fsp.OpenFile(s, "/read.bin", "rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	var buff = make([]byte, fsp.FSPSpace)
+	for {
+		n, err := f.Read(buff, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, buff[:n]...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes, want %d", len(got), len(data))
+	}
+
+	// seek back and read the tail again
+	if err = f.SeekTo(4000); err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.Read(buff, 1, 1)
+	if err != nil || !bytes.Equal(buff[:n], data[4000:4000+n]) || n == 0 {
+		t.Fatalf("read after seek %d bytes, %v", n, err)
+	}
+}
+
+func TestFileWrite(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(3000)
+	f, err := fsp.OpenFile(s, "/up/write.bin", "wb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Mkdir("/up")
+	for pos := 0; pos < len(data); pos += 700 {
+		var end = pos + 700
+		if end > len(data) {
+			end = len(data)
+		}
+		if err = f.Write(data[pos:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := srv.ReadFile("/up/write.bin")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("server got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestFileAbort(t *testing.T) {
+	var srv, s = startServer(t)
+	f, err := fsp.OpenFile(s, "/aborted.bin", "wb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Write(testData(2000)); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Write([]byte("more")); err == nil {
+		t.Error("write after abort succeeded")
+	}
+	if srv.Exists("/aborted.bin") {
+		t.Error("aborted upload installed")
+	}
+
+	// the next upload start from an empty file
+	f, _ = fsp.OpenFile(s, "/aborted.bin", "wb")
+	f.Write([]byte("fresh"))
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.ReadFile("/aborted.bin"); string(got) != "fresh" {
+		t.Errorf("got %q after abort and upload", got)
+	}
+}
@@ -1,7 +1,11 @@
 package fsp
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -46,10 +50,50 @@ func (s fileStat) Sys() interface{} {
 	return nil
 }
 
+// DirList is the result of listing a directory
+type DirList struct {
+	Path       string        // directory name
+	Protection uint8         // directory protection bits, zero if server not report it
+	Entries    []os.FileInfo // directory entries without "." and ".."
+	Files      int           // number of files
+	Dirs       int           // number of sub directories
+	Links      int           // number of links
+	Size       int64         // total size of files
+}
+
+// EntryType return "dir", "link" or "file" by the mode of entry
+func EntryType(fi os.FileInfo) string {
+	if fi.IsDir() {
+		return "dir"
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return "link"
+	}
+	return "file"
+}
+
+// EntryString format entry as one line of directory listing
+func EntryString(fi os.FileInfo) string {
+	return fmt.Sprintf("%-7s%10d %s %s", EntryType(fi), fi.Size(), fi.ModTime().Format("2006/01/02 15:04:05"), fi.Name())
+}
+
+// errors reported by the fsp package, check them with errors.Is
+var (
+	ErrNotExist    = fs.ErrNotExist // file or directory does not exist
+	ErrExist       = fs.ErrExist    // file already exists
+	ErrPermission  = fs.ErrPermission
+	ErrTimeout     = errors.New("fsp: transaction timeout")
+	ErrNameTooLong = errors.New("fsp: file name too long")
+	ErrChecksum    = errors.New("fsp: checksum mismatch")
+	ErrTooLarge    = errors.New("fsp: file too large")
+)
+
 // fspError is the error type usually returned by functions in the fsp package
 type fspError struct {
 	Cmd    uint8  // FSP command operator
 	Reason string // FSP command fail reason
+	Code   uint16 // error status code of CC_ERR extra data, 0 if not sent
+	Kind   error  // one of the Err variables, nil if not known
 	Err    error
 }
 
@@ -60,18 +104,86 @@ func newOpError(errStr string) (err *fspError) {
 	return
 }
 
+func newKindError(kind error, errStr string) (err *fspError) {
+	err = newOpError(errStr)
+	err.Kind = kind
+	return
+}
+
+// newServerError build error from CC_ERR reply
+/*
+	reply
+	file position:  size of extra data
+	data:           ASCIIZ Error string
+	xtra data:      not required
+	                word - error status code
+*/
+func newServerError(resp *fspPacket) (err *fspError) {
+	var reason = resp.buf[:resp.len]
+	if n := bytes.IndexByte(reason, 0); n >= 0 {
+		reason = reason[:n]
+	}
+	err = &fspError{Cmd: resp.cmd, Reason: string(reason)}
+	// old servers leave garbage in position, only trust it when it is 2
+	if resp.pos == 2 && resp.xlen >= 2 {
+		err.Code = binary.BigEndian.Uint16(resp.buf[resp.len:])
+	}
+	if err.Reason == "" {
+		err.Reason = fmt.Sprintf("server error, code %d", err.Code)
+	}
+	err.Kind = errorKind(err.Reason)
+	return
+}
+
+// errorKind guess the kind of server error from its message
+func errorKind(reason string) error {
+	var lower = strings.ToLower(reason)
+	switch {
+	case strings.Contains(lower, "no such"), strings.Contains(lower, "not found"),
+		strings.Contains(lower, "not exist"):
+		return ErrNotExist
+	case strings.Contains(lower, "exist"):
+		return ErrExist
+	case strings.Contains(lower, "permission"), strings.Contains(lower, "denied"),
+		strings.Contains(lower, "not allowed"), strings.Contains(lower, "password"):
+		return ErrPermission
+	case strings.Contains(lower, "too long"):
+		return ErrNameTooLong
+	case strings.Contains(lower, "time out"), strings.Contains(lower, "timeout"):
+		return ErrTimeout
+	}
+	return nil
+}
+
+// ErrorCode return the error status code sent by server with CC_ERR, zero
+// when err is not a server error or the server did not send a code
+func ErrorCode(err error) uint16 {
+	var e *fspError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
 // Timeout check is time out error
 func (e *fspError) Timeout() bool {
 	if e == nil {
 		return false
 	}
-	if strings.Contains(e.Reason, "time out") {
-		return true
-	}
-	if e.Err != nil && strings.Contains(e.Err.Error(), "timeout") {
-		return true
+	return e.Is(ErrTimeout) || errors.Is(e.Err, os.ErrDeadlineExceeded)
+}
+
+// Is report whether the error is of the kind target
+func (e *fspError) Is(target error) bool {
+	if e == nil || e.Kind == nil {
+		return false
 	}
-	return false
+	return e.Kind == target
+}
+
+// Unwrap return the underlying error
+func (e *fspError) Unwrap() error {
+	return e.Err
 }
 
 func (e *fspError) Error() string {
@@ -81,8 +193,10 @@ func (e *fspError) Error() string {
 	}
 	if e.Reason != "" {
 		s = e.Reason
-	} else {
+	} else if e.Err != nil {
 		s = e.Err.Error()
+	} else {
+		s = "fsp error"
 	}
 	return s
 }
@@ -0,0 +1,43 @@
+package fsp_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/finove/fsp"
+)
+
+func TestServerErrorCode(t *testing.T) {
+	var _, s = startServer(t)
+	var err = s.Remove("/missing.txt")
+	if !errors.Is(err, fsp.ErrNotExist) {
+		t.Fatalf("got %v, want ErrNotExist", err)
+	}
+	if code := fsp.ErrorCode(err); code != 2 {
+		t.Errorf("got code %d, want 2", code)
+	}
+}
+
+func TestServerErrorEmptyMessage(t *testing.T) {
+	var s = pipeSession(t, func(req *fsp.Packet) *fsp.Packet {
+		return &fsp.Packet{Cmd: fsp.FSPCommandErr}
+	})
+	var _, err = s.Stat("/file")
+	if err == nil {
+		t.Fatal("no error for CC_ERR reply")
+	}
+	if err.Error() == "" {
+		t.Error("empty error message")
+	}
+}
+
+func TestStatPaddedReply(t *testing.T) {
+	var s = pipeSession(t, func(req *fsp.Packet) *fsp.Packet {
+		// time, size 1000, type file and 4 padding bytes
+		return &fsp.Packet{Cmd: req.Cmd, Data: []byte{0, 0, 0, 1, 0, 0, 0x03, 0xe8, 1, 0xff, 0xff, 0xff, 0xff}}
+	})
+	fi, err := s.Stat("/file")
+	if err != nil || fi.Size() != 1000 {
+		t.Fatalf("got size %v, %v, want 1000", fi.Size(), err)
+	}
+}
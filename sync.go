@@ -0,0 +1,355 @@
+package fsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncDirection which side a sync change
+type SyncDirection int
+
+// sync directions
+const (
+	SyncUpload   SyncDirection = iota // make remote like local
+	SyncDownload                      // make local like remote
+	SyncBoth                          // copy the newer side both ways
+)
+
+// SyncAction one step of a sync plan
+type SyncAction int
+
+// sync actions
+const (
+	SyncNone SyncAction = iota
+	SyncPut             // upload local file
+	SyncGet             // download remote file
+	SyncMkdirRemote
+	SyncMkdirLocal
+	SyncDeleteRemote
+	SyncDeleteLocal
+	SyncConflict // both sides changed, nothing is done
+)
+
+var syncActionNames = []string{"none", "upload", "download", "mkdir-remote", "mkdir-local",
+	"delete-remote", "delete-local", "conflict"}
+
+func (a SyncAction) String() string {
+	if int(a) < len(syncActionNames) {
+		return syncActionNames[a]
+	}
+	return fmt.Sprintf("action-%d", int(a))
+}
+
+// SyncOptions options of PlanSync
+type SyncOptions struct {
+	Direction SyncDirection
+	Delete    bool      // delete entries missing on the other side
+	LastSync  time.Time // SyncBoth: previous sync, files changed on both sides after it are conflicts
+}
+
+// SyncStep one change of a sync plan
+type SyncStep struct {
+	Action SyncAction
+	Path   string      // slash separated path relative to both roots
+	Local  os.FileInfo // nil when missing locally
+	Remote os.FileInfo // nil when missing on server
+	Reason string
+}
+
+// SyncPlan changes making a local and a remote tree equal, compared by
+// name, size and modification time
+type SyncPlan struct {
+	LocalDir  string
+	RemoteDir string
+	Steps     []SyncStep
+}
+
+// Print write one line per step
+func (p *SyncPlan) Print(w io.Writer) {
+	for _, step := range p.Steps {
+		fmt.Fprintf(w, "%-13s %s (%s)\n", step.Action, step.Path, step.Reason)
+	}
+}
+
+// SyncResult outcome of one step
+type SyncResult struct {
+	Step SyncStep
+	Err  error
+}
+
+// SyncReport outcome of Sync
+type SyncReport struct {
+	Results   []SyncResult
+	Done      int // steps done
+	Failed    int // steps failed
+	Conflicts int // conflicts left alone
+}
+
+// Err return nil when every step is done, otherwise an error listing the
+// failed steps and conflicts
+func (r *SyncReport) Err() error {
+	if r == nil || r.Failed+r.Conflicts == 0 {
+		return nil
+	}
+	var msg = fmt.Sprintf("%d of %d steps fail, %d conflicts", r.Failed, len(r.Results), r.Conflicts)
+	for _, res := range r.Results {
+		if res.Err != nil {
+			msg += fmt.Sprintf("; %s %s: %v", res.Step.Action, res.Step.Path, res.Err)
+		} else if res.Step.Action == SyncConflict {
+			msg += fmt.Sprintf("; conflict %s: %s", res.Step.Path, res.Step.Reason)
+		}
+	}
+	return newOpError(msg)
+}
+
+// PlanSync compare localDir with remoteDir and return the steps making them
+// equal in the direction of opts, nothing is changed
+func (s *Session) PlanSync(localDir, remoteDir string, opts *SyncOptions) (plan *SyncPlan, err error) {
+	var local, remote map[string]os.FileInfo
+	var names []string
+	var deleted []string
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	local, err = localTree(localDir)
+	if err != nil {
+		return
+	}
+	remote, err = s.remoteTree(remoteDir)
+	if err != nil {
+		return
+	}
+	for name := range local {
+		names = append(names, name)
+	}
+	for name := range remote {
+		if _, ok := local[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	plan = &SyncPlan{LocalDir: localDir, RemoteDir: remoteDir}
+	if opts.Direction != SyncDownload && len(local) > 0 {
+		if _, e := s.Stat(remoteDir); errors.Is(e, ErrNotExist) {
+			plan.Steps = append(plan.Steps, SyncStep{Action: SyncMkdirRemote, Path: ".", Reason: "missing on server"})
+		}
+	}
+	for _, name := range names {
+		if underAny(name, deleted) {
+			continue
+		}
+		var step = planStep(name, local[name], remote[name], opts)
+		if step.Action == SyncNone {
+			continue
+		}
+		if (step.Action == SyncDeleteLocal || step.Action == SyncDeleteRemote) &&
+			((step.Local != nil && step.Local.IsDir()) || (step.Remote != nil && step.Remote.IsDir())) {
+			deleted = append(deleted, name)
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return
+}
+
+// planStep compare one entry present on at least one side
+func planStep(name string, l, r os.FileInfo, opts *SyncOptions) (step SyncStep) {
+	step = SyncStep{Path: name, Local: l, Remote: r}
+	var up, down = opts.Direction != SyncDownload, opts.Direction != SyncUpload
+	switch {
+	case l != nil && r != nil:
+		if l.IsDir() != r.IsDir() {
+			step.Action, step.Reason = SyncConflict, "file on one side, directory on the other"
+		} else if l.IsDir() || sameFile(l, r) {
+			return
+		} else if opts.Direction == SyncUpload {
+			step.Action, step.Reason = SyncPut, "size or time differ"
+		} else if opts.Direction == SyncDownload {
+			step.Action, step.Reason = SyncGet, "size or time differ"
+		} else if !opts.LastSync.IsZero() && l.ModTime().After(opts.LastSync) && r.ModTime().After(opts.LastSync) {
+			step.Action, step.Reason = SyncConflict, "changed on both sides"
+		} else if l.ModTime().Unix() > r.ModTime().Unix() {
+			step.Action, step.Reason = SyncPut, "local is newer"
+		} else if l.ModTime().Unix() < r.ModTime().Unix() {
+			step.Action, step.Reason = SyncGet, "remote is newer"
+		} else {
+			step.Action, step.Reason = SyncConflict, "same time, size differ"
+		}
+	case l != nil:
+		if opts.Direction == SyncBoth && opts.Delete && !opts.LastSync.IsZero() && l.ModTime().Before(opts.LastSync) {
+			step.Action, step.Reason = SyncDeleteLocal, "removed from server"
+		} else if up && l.IsDir() {
+			step.Action, step.Reason = SyncMkdirRemote, "missing on server"
+		} else if up {
+			step.Action, step.Reason = SyncPut, "missing on server"
+		} else if opts.Delete {
+			step.Action, step.Reason = SyncDeleteLocal, "missing on server"
+		}
+	case r != nil:
+		if EntryType(r) == "link" {
+			return
+		}
+		if opts.Direction == SyncBoth && opts.Delete && !opts.LastSync.IsZero() && r.ModTime().Before(opts.LastSync) {
+			step.Action, step.Reason = SyncDeleteRemote, "removed locally"
+		} else if down && r.IsDir() {
+			step.Action, step.Reason = SyncMkdirLocal, "missing locally"
+		} else if down {
+			step.Action, step.Reason = SyncGet, "missing locally"
+		} else if opts.Delete {
+			step.Action, step.Reason = SyncDeleteRemote, "missing locally"
+		}
+	}
+	return
+}
+
+// sameFile compare size and modification time in seconds
+func sameFile(l, r os.FileInfo) bool {
+	return l.Size() == r.Size() && l.ModTime().Unix() == r.ModTime().Unix()
+}
+
+// underAny report whether name is below one of dirs
+func underAny(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// localTree regular files and directories below root by relative slash path
+func localTree(root string) (tree map[string]os.FileInfo, err error) {
+	tree = make(map[string]os.FileInfo)
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == root {
+				// a missing root is an empty tree
+				return fs.SkipAll
+			}
+			return err
+		}
+		if name == root || !(d.IsDir() || d.Type().IsRegular()) {
+			return nil
+		}
+		var rel, _ = filepath.Rel(root, name)
+		var fi, e = d.Info()
+		if e != nil {
+			return e
+		}
+		tree[filepath.ToSlash(rel)] = fi
+		return nil
+	})
+	return
+}
+
+// remoteTree entries below root by relative path
+func (s *Session) remoteTree(root string) (tree map[string]os.FileInfo, err error) {
+	var base = cleanPath(root)
+	tree = make(map[string]os.FileInfo)
+	err = s.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil && errors.Is(err, ErrNotExist) {
+				// a missing root is an empty tree
+				return fs.SkipAll
+			}
+			return err
+		}
+		var clean = cleanPath(name)
+		if clean == base {
+			return nil
+		}
+		var fi, e = d.Info()
+		if e != nil {
+			return e
+		}
+		tree[strings.TrimPrefix(strings.TrimPrefix(clean, base), "/")] = fi
+		return nil
+	})
+	return
+}
+
+// Sync execute plan: directories are created first, then files are copied
+// and at last entries are deleted, deepest first. Copied files keep the
+// modification time of their source so the next plan find them equal.
+// Conflicts are left alone and counted in the report.
+func (s *Session) Sync(plan *SyncPlan) (report *SyncReport) {
+	var phases = [][]SyncAction{
+		{SyncMkdirRemote, SyncMkdirLocal},
+		{SyncPut, SyncGet},
+		{SyncDeleteRemote, SyncDeleteLocal},
+	}
+	report = &SyncReport{}
+	for i, actions := range phases {
+		var steps []SyncStep
+		for _, step := range plan.Steps {
+			if step.Action == actions[0] || step.Action == actions[1] {
+				steps = append(steps, step)
+			}
+		}
+		if i == len(phases)-1 {
+			sort.Slice(steps, func(a, b int) bool { return steps[a].Path > steps[b].Path })
+		}
+		for _, step := range steps {
+			var err = s.syncStep(plan, step)
+			report.Results = append(report.Results, SyncResult{Step: step, Err: err})
+			if err != nil {
+				report.Failed++
+			} else {
+				report.Done++
+			}
+		}
+	}
+	for _, step := range plan.Steps {
+		if step.Action == SyncConflict {
+			report.Conflicts++
+			report.Results = append(report.Results, SyncResult{Step: step})
+		}
+	}
+	return
+}
+
+func (s *Session) syncStep(plan *SyncPlan, step SyncStep) (err error) {
+	var localPath = filepath.Join(plan.LocalDir, filepath.FromSlash(step.Path))
+	var remotePath = path.Join(plan.RemoteDir, step.Path)
+	switch step.Action {
+	case SyncMkdirRemote:
+		err = s.Mkdir(remotePath)
+	case SyncMkdirLocal:
+		err = os.MkdirAll(localPath, os.ModePerm)
+	case SyncPut:
+		var fp *os.File
+		if fp, err = os.Open(localPath); err != nil {
+			return
+		}
+		defer fp.Close()
+		_, err = s.Upload(context.Background(), remotePath, fp, &UploadOptions{ModTime: step.Local.ModTime(), Atomic: s.atomic})
+	case SyncGet:
+		var tmpPath = localPath + ".tmp"
+		if err = s.getFile(remotePath, tmpPath, 3); err == nil {
+			err = os.Chtimes(tmpPath, step.Remote.ModTime(), step.Remote.ModTime())
+		}
+		if err == nil {
+			err = os.Rename(tmpPath, localPath)
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	case SyncDeleteRemote:
+		if step.Remote.IsDir() {
+			err = s.RemoveAll(remotePath)
+		} else {
+			err = s.Remove(remotePath)
+		}
+	case SyncDeleteLocal:
+		err = os.RemoveAll(localPath)
+	}
+	return
+}
@@ -0,0 +1,108 @@
+package fsp_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// writeLocal create file name below dir with data and modification time
+func writeLocal(t *testing.T, dir, name, data string, modTime time.Time) {
+	var p = filepath.Join(dir, filepath.FromSlash(name))
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(p, modTime, modTime)
+}
+
+// planString return "action path" of each step
+func planString(plan *fsp.SyncPlan) string {
+	var steps []string
+	for _, step := range plan.Steps {
+		steps = append(steps, step.Action.String()+" "+step.Path)
+	}
+	return strings.Join(steps, ", ")
+}
+
+// syncTwice run a plan, check it succeeded and that planning again is empty
+func syncTwice(t *testing.T, s *fsp.Session, local, remote string, opts *fsp.SyncOptions, want string) {
+	t.Helper()
+	plan, err := s.PlanSync(local, remote, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := planString(plan); got != want {
+		t.Fatalf("got plan %s, want %s", got, want)
+	}
+	if err = s.Sync(plan).Err(); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = s.PlanSync(local, remote, opts)
+	if err != nil || len(plan.Steps) != 0 {
+		t.Errorf("second plan %s, %v", planString(plan), err)
+	}
+}
+
+func TestSyncUpload(t *testing.T) {
+	var srv, s = startServer(t)
+	var local = t.TempDir()
+	var modTime = time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeLocal(t, local, "a.txt", "aaa", modTime)
+	writeLocal(t, local, "sub/b.txt", "bbb", modTime)
+	srv.Mkdir("/")
+	syncTwice(t, s, local, "/site", &fsp.SyncOptions{Direction: fsp.SyncUpload},
+		"mkdir-remote ., upload a.txt, mkdir-remote sub, upload sub/b.txt")
+	if got, _ := srv.ReadFile("/site/sub/b.txt"); string(got) != "bbb" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSyncDownloadDelete(t *testing.T) {
+	var srv, s = startServer(t)
+	var local = t.TempDir()
+	var modTime = time.Now().Add(-time.Hour)
+	srv.WriteFile("/site/a.txt", []byte("remote a"), modTime)
+	srv.WriteFile("/site/sub/b.txt", []byte("remote b"), modTime)
+	writeLocal(t, local, "a.txt", "old a", modTime.Add(-time.Hour))
+	writeLocal(t, local, "extra/c.txt", "c", modTime)
+	syncTwice(t, s, local, "/site", &fsp.SyncOptions{Direction: fsp.SyncDownload, Delete: true},
+		"download a.txt, delete-local extra, mkdir-local sub, download sub/b.txt")
+	if data, _ := os.ReadFile(filepath.Join(local, "a.txt")); string(data) != "remote a" {
+		t.Errorf("got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(local, "extra")); !os.IsNotExist(err) {
+		t.Errorf("extra not deleted, %v", err)
+	}
+}
+
+func TestSyncBothConflict(t *testing.T) {
+	var srv, s = startServer(t)
+	var local = t.TempDir()
+	var lastSync = time.Now().Add(-time.Hour).Truncate(time.Second)
+	srv.WriteFile("/site/both.txt", []byte("remote"), lastSync.Add(time.Minute))
+	writeLocal(t, local, "both.txt", "local!", lastSync.Add(2*time.Minute))
+	srv.WriteFile("/site/newer.txt", []byte("remote newer"), lastSync.Add(time.Minute))
+	writeLocal(t, local, "newer.txt", "local", lastSync.Add(-time.Minute))
+	plan, err := s.PlanSync(local, "/site", &fsp.SyncOptions{Direction: fsp.SyncBoth, LastSync: lastSync})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := planString(plan); got != "conflict both.txt, download newer.txt" {
+		t.Fatalf("got plan %s", got)
+	}
+	var report = s.Sync(plan)
+	if report.Conflicts != 1 || report.Done != 1 || report.Err() == nil {
+		t.Errorf("got %d conflicts %d done, %v", report.Conflicts, report.Done, report.Err())
+	}
+	if got, _ := srv.ReadFile("/site/both.txt"); string(got) != "remote" {
+		t.Errorf("conflict changed the server file to %q", got)
+	}
+}
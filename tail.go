@@ -0,0 +1,144 @@
+package fsp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Tail read a growing remote file, see Session.Tail
+type Tail struct {
+	Interval   time.Duration // poll interval, 1 second by default
+	Follow     bool          // wait for new data, otherwise Read return io.EOF at the end
+	OnTruncate func()        // called when the file shrink or its time go back, reading restart at 0
+
+	s       *Session
+	name    string
+	f       *File
+	offset  int64
+	modTime time.Time
+	chunk   []byte
+	buf     []byte
+	done    chan struct{}
+}
+
+// Tail open name for following like tail -f, reading start fromEnd bytes
+// before the current end, a negative fromEnd start at the beginning. Read
+// poll Stat for growth and fetch only the new bytes by file position. When
+// the file is truncated or rotated, found by a smaller size or an older
+// modification time, reading restart at its beginning. A missing file is
+// waited for.
+func (s *Session) Tail(name string, fromEnd int64) (t *Tail, err error) {
+	var fi os.FileInfo
+	t = &Tail{
+		Interval: time.Second,
+		Follow:   true,
+		s:        s,
+		name:     name,
+		chunk:    make([]byte, FSPSpace),
+		done:     make(chan struct{}),
+	}
+	t.f, err = s.openFile(name, "rb")
+	if err != nil {
+		t = nil
+		return
+	}
+	fi, err = t.stat()
+	if errors.Is(err, ErrNotExist) {
+		// not there yet, Read wait for it and start at its beginning
+		err = nil
+		return
+	} else if err != nil {
+		t = nil
+		return
+	}
+	t.modTime = fi.ModTime()
+	if fromEnd >= 0 && fromEnd < fi.Size() {
+		t.offset = fi.Size() - fromEnd
+	}
+	return
+}
+
+// Offset return the position of the next byte to read
+func (t *Tail) Offset() int64 {
+	return t.offset - int64(len(t.buf))
+}
+
+// Read new data of the file, with Follow it block until data arrive or
+// Close is called
+func (t *Tail) Read(p []byte) (n int, err error) {
+	for len(t.buf) == 0 {
+		select {
+		case <-t.done:
+			return 0, io.EOF
+		default:
+		}
+		if err = t.fill(); err != nil {
+			return
+		}
+		if len(t.buf) > 0 {
+			break
+		}
+		if !t.Follow {
+			return 0, io.EOF
+		}
+		select {
+		case <-t.done:
+			return 0, io.EOF
+		case <-time.After(t.Interval):
+		}
+	}
+	n = copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return
+}
+
+// Close stop following, a blocked Read return io.EOF
+func (t *Tail) Close() error {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	return nil
+}
+
+// stat the file bypassing the session cache
+func (t *Tail) stat() (fi os.FileInfo, err error) {
+	t.s.cache.drop(cacheStat, t.name)
+	return t.s.Stat(t.name)
+}
+
+// fill read the next packet of new data into buf
+func (t *Tail) fill() (err error) {
+	var fi os.FileInfo
+	var done int
+	fi, err = t.stat()
+	if errors.Is(err, ErrNotExist) {
+		// rotated away, wait for the new file
+		return nil
+	} else if err != nil {
+		return
+	}
+	if fi.Size() < t.offset || fi.ModTime().Before(t.modTime) {
+		t.offset = 0
+		if t.OnTruncate != nil {
+			t.OnTruncate()
+		}
+	}
+	t.modTime = fi.ModTime()
+	if fi.Size() <= t.offset {
+		return
+	}
+	t.f.pos = t.offset
+	t.f.eof = false
+	// one packet at a time, File.Read may overrun a short buffer
+	done, err = t.f.Read(t.chunk, 1, 1)
+	if err != nil {
+		return
+	}
+	t.offset += int64(done)
+	t.buf = t.chunk[:done]
+	return
+}
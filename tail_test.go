@@ -0,0 +1,117 @@
+package fsp_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// readTail read what the tail has now without waiting
+func readTail(t *testing.T, tail *fsp.Tail) string {
+	t.Helper()
+	tail.Follow = false
+	data, err := io.ReadAll(tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTailFromEnd(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.WriteFile("/app.log", []byte("line1\nline2\n"), time.Now())
+	for _, tc := range []struct {
+		fromEnd int64
+		want    string
+	}{
+		{6, "line2\n"},
+		{0, ""},
+		{-1, "line1\nline2\n"},
+		{100, "line1\nline2\n"},
+	} {
+		tail, err := s.Tail("/app.log", tc.fromEnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readTail(t, tail); got != tc.want {
+			t.Errorf("fromEnd %d got %q, want %q", tc.fromEnd, got, tc.want)
+		}
+	}
+}
+
+func TestTailFollow(t *testing.T) {
+	var srv, s = startServer(t)
+	var modTime = time.Now().Add(-time.Hour)
+	srv.WriteFile("/app.log", []byte("old\n"), modTime)
+	tail, err := s.Tail("/app.log", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail.Interval = 10 * time.Millisecond
+	var got = make(chan string, 1)
+	go func() {
+		var buf = make([]byte, 4)
+		n, _ := io.ReadFull(tail, buf)
+		got <- string(buf[:n])
+	}()
+	time.Sleep(30 * time.Millisecond)
+	srv.WriteFile("/app.log", []byte("old\nnew\n"), modTime.Add(time.Second))
+	select {
+	case data := <-got:
+		if data != "new\n" {
+			t.Errorf("got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("growth not read")
+	}
+	if tail.Offset() != 8 {
+		t.Errorf("offset %d", tail.Offset())
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		tail.Close()
+	}()
+	if n, err := tail.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("read after Close got %d, %v", n, err)
+	}
+}
+
+func TestTailTruncate(t *testing.T) {
+	var srv, s = startServer(t)
+	var modTime = time.Now().Add(-time.Hour)
+	var truncated int
+	srv.WriteFile("/app.log", []byte("first file\n"), modTime)
+	tail, err := s.Tail("/app.log", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail.OnTruncate = func() { truncated++ }
+	if got := readTail(t, tail); got != "first file\n" {
+		t.Fatalf("got %q", got)
+	}
+	srv.WriteFile("/app.log", []byte("rotated\n"), modTime.Add(time.Second))
+	if got := readTail(t, tail); got != "rotated\n" || truncated != 1 {
+		t.Errorf("got %q, %d truncates", got, truncated)
+	}
+	srv.WriteFile("/app.log", []byte("same size!!\n"), modTime.Add(-time.Minute))
+	if got := readTail(t, tail); got != "same size!!\n" || truncated != 2 {
+		t.Errorf("older file got %q, %d truncates", got, truncated)
+	}
+}
+
+func TestTailMissingFile(t *testing.T) {
+	var srv, s = startServer(t)
+	tail, err := s.Tail("/late.log", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTail(t, tail); got != "" {
+		t.Errorf("got %q before the file exist", got)
+	}
+	srv.WriteFile("/late.log", []byte("hello\n"), time.Now())
+	if got := readTail(t, tail); got != "hello\n" {
+		t.Errorf("got %q", got)
+	}
+}
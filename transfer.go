@@ -0,0 +1,171 @@
+package fsp
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TransferJob one file to copy between local disk and fsp server
+type TransferJob struct {
+	Upload bool   // false download Remote to Local, true upload Local to Remote
+	Remote string // remote file path
+	Local  string // local file path
+}
+
+// TransferResult outcome of one transfer job
+type TransferResult struct {
+	Job      TransferJob
+	Attempts int   // number of tries, including the successful one
+	Size     int64 // bytes transferred
+	Err      error // last error, nil when the job succeeded
+}
+
+// TransferReport aggregated outcome of TransferManager.Run
+type TransferReport struct {
+	Results []TransferResult // one result per job, in the order jobs were added
+	Done    int              // number of succeeded jobs
+	Failed  int              // number of failed jobs
+	Size    int64            // total bytes transferred
+}
+
+// Err return nil when all jobs succeeded, otherwise an error listing the
+// failed files
+func (r *TransferReport) Err() error {
+	if r == nil || r.Failed == 0 {
+		return nil
+	}
+	var msg = fmt.Sprintf("%d of %d transfers fail", r.Failed, len(r.Results))
+	for _, res := range r.Results {
+		if res.Err != nil {
+			msg += fmt.Sprintf("; %s: %v", res.Job.Remote, res.Err)
+		}
+	}
+	return newOpError(msg)
+}
+
+// TransferManager runs transfer jobs in parallel. Each worker owns a session
+// on its own local port, all of them share the key store of the session
+// given to NewTransferManager. A failed job is retried on its own without
+// stopping the other jobs.
+type TransferManager struct {
+	Workers int // max number of parallel sessions, at least 1
+	Retry   int // extra tries for a failed job
+	s       *Session
+	jobs    []TransferJob
+}
+
+// NewTransferManager return a transfer manager using s as first worker
+func NewTransferManager(s *Session, workers int) *TransferManager {
+	if workers < 1 {
+		workers = 1
+	}
+	return &TransferManager{
+		Workers: workers,
+		Retry:   3,
+		s:       s,
+	}
+}
+
+// Add queue jobs
+func (m *TransferManager) Add(jobs ...TransferJob) {
+	m.jobs = append(m.jobs, jobs...)
+}
+
+// Run execute all queued jobs and wait for them
+func (m *TransferManager) Run() (report *TransferReport) {
+	var wg sync.WaitGroup
+	var queue = make(chan int)
+	var sessions = []*Session{m.s}
+	report = &TransferReport{Results: make([]TransferResult, len(m.jobs))}
+	for i := 1; i < m.Workers && i < len(m.jobs); i++ {
+		sess, err := m.s.fork()
+		if err != nil {
+			m.s.verbose(0, "open worker session fail, %v", err)
+			break
+		}
+		sessions = append(sessions, sess)
+	}
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func(sess *Session) {
+			defer wg.Done()
+			for i := range queue {
+				report.Results[i] = m.runJob(sess, m.jobs[i])
+			}
+		}(sess)
+	}
+	for i := range m.jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	for _, sess := range sessions[1:] {
+		sess.Close()
+	}
+	for _, res := range report.Results {
+		if res.Err != nil {
+			report.Failed++
+		} else {
+			report.Done++
+			report.Size += res.Size
+		}
+	}
+	m.jobs = nil
+	return
+}
+
+func (m *TransferManager) runJob(s *Session, job TransferJob) (res TransferResult) {
+	res.Job = job
+	for res.Attempts <= m.Retry {
+		res.Attempts++
+		if job.Upload {
+			res.Size, res.Err = s.uploadJob(job)
+		} else {
+			res.Size, res.Err = s.downloadJob(job)
+		}
+		if res.Err == nil {
+			break
+		}
+		s.verbose(0, "transfer %s fail, try %d, %v", job.Remote, res.Attempts, res.Err)
+	}
+	return
+}
+
+// downloadJob download to a temporary file then rename it into place
+func (s *Session) downloadJob(job TransferJob) (size int64, err error) {
+	var stat os.FileInfo
+	var tmpSaveFile = job.Local + ".tmp"
+	stat, err = s.Stat(job.Remote)
+	if err != nil {
+		return
+	}
+	if s.skipSame && unchanged(job.Local, stat) {
+		return
+	}
+	s.startDownload(stat.Size())
+	err = s.getFile(job.Remote, tmpSaveFile, 0)
+	s.finishDownload()
+	if err != nil {
+		os.Remove(tmpSaveFile)
+		return
+	}
+	err = os.Rename(tmpSaveFile, job.Local)
+	if err == nil {
+		size = stat.Size()
+	}
+	return
+}
+
+func (s *Session) uploadJob(job TransferJob) (size int64, err error) {
+	var stat os.FileInfo
+	stat, err = os.Stat(job.Local)
+	if err != nil {
+		return
+	}
+	err = s.UploadFile(job.Local, job.Remote)
+	if err == nil {
+		size = stat.Size()
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package fsp_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestTransferManager(t *testing.T) {
+	var srv, s = startServer(t)
+	var dir = t.TempDir()
+	var manager = fsp.NewTransferManager(s, 2)
+	for i := 0; i < 4; i++ {
+		var name = fmt.Sprintf("/data/f%d.txt", i)
+		srv.WriteFile(name, []byte(name), time.Now())
+		manager.Add(fsp.TransferJob{Remote: name, Local: filepath.Join(dir, filepath.Base(name))})
+	}
+	manager.Add(fsp.TransferJob{Remote: "/data/missing.txt", Local: filepath.Join(dir, "missing.txt")})
+	manager.Retry = 0
+	var report = manager.Run()
+	if report.Done != 4 || report.Failed != 1 {
+		t.Fatalf("done %d failed %d, want 4 and 1", report.Done, report.Failed)
+	}
+	if report.Err() == nil {
+		t.Fatal("report error is nil with a failed job")
+	}
+	for _, res := range report.Results[:4] {
+		data, err := os.ReadFile(res.Job.Local)
+		if err != nil || string(data) != res.Job.Remote {
+			t.Errorf("%s: got %q, %v", res.Job.Local, data, err)
+		}
+	}
+}
+
+func TestDownloadDirectoryContinueAfterFailure(t *testing.T) {
+	var srv, s = startServer(t)
+	var dir = t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		srv.WriteFile("/pub/"+name, []byte("data of "+name), time.Now())
+	}
+	// a non empty directory in place of b.txt make its rename fail
+	if err := os.MkdirAll(filepath.Join(dir, "b.txt", "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var err = s.DownloadDirectory("/pub", dir)
+	if err == nil {
+		t.Fatal("no error for the failed file")
+	}
+	for _, name := range []string{"a.txt", "c.txt"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != "data of "+name {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+}
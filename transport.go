@@ -0,0 +1,219 @@
+package fsp
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport carries FSP datagrams between client and server
+type Transport interface {
+	// Send write one datagram
+	Send(buff []byte) error
+	// Receive read one datagram into buff, it fails with a timeout error
+	// when nothing arrives before deadline
+	Receive(buff []byte, deadline time.Time) (n int, err error)
+	// Close release the transport
+	Close() error
+	// String describe the transport endpoints for logging
+	String() string
+}
+
+// errTransportTimeout is returned by Receive of pipe and stream transports
+var errTransportTimeout = newKindError(ErrTimeout, "receive timeout")
+
+// errTransportClosed is returned by Send and Receive after Close
+var errTransportClosed = newOpError("transport closed")
+
+// udpTransport standard FSP transport
+type udpTransport struct {
+	conn *net.UDPConn
+	addr *net.UDPAddr
+}
+
+// NewUDPTransport return a transport sending to addr through conn
+func NewUDPTransport(conn *net.UDPConn, addr *net.UDPAddr) Transport {
+	return &udpTransport{conn: conn, addr: addr}
+}
+
+func (t *udpTransport) Send(buff []byte) (err error) {
+	_, err = t.conn.WriteToUDP(buff, t.addr)
+	return
+}
+
+func (t *udpTransport) Receive(buff []byte, deadline time.Time) (n int, err error) {
+	t.conn.SetReadDeadline(deadline)
+	return t.conn.Read(buff)
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *udpTransport) String() string {
+	return t.conn.LocalAddr().String() + " to " + t.addr.String()
+}
+
+// pipeEnd one end of an in-memory datagram pipe
+type pipeEnd struct {
+	name string
+	in   chan []byte
+	out  chan []byte
+	done chan struct{}
+	once *sync.Once
+}
+
+// NewPipe return the two ends of an in-memory datagram pipe, what is sent
+// on one end is received on the other. Datagrams are dropped when the
+// receiver falls behind, like on a real network.
+func NewPipe() (client, server Transport) {
+	var a = make(chan []byte, 64)
+	var b = make(chan []byte, 64)
+	var done = make(chan struct{})
+	var once = &sync.Once{}
+	client = &pipeEnd{name: "pipe client", in: a, out: b, done: done, once: once}
+	server = &pipeEnd{name: "pipe server", in: b, out: a, done: done, once: once}
+	return
+}
+
+func (p *pipeEnd) Send(buff []byte) error {
+	select {
+	case <-p.done:
+		return errTransportClosed
+	case p.out <- append([]byte(nil), buff...):
+	default:
+	}
+	return nil
+}
+
+func (p *pipeEnd) Receive(buff []byte, deadline time.Time) (n int, err error) {
+	return receiveChan(p.in, p.done, buff, deadline)
+}
+
+func (p *pipeEnd) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *pipeEnd) String() string {
+	return p.name
+}
+
+// receiveChan wait for a datagram on ch until deadline
+func receiveChan(ch chan []byte, done chan struct{}, buff []byte, deadline time.Time) (n int, err error) {
+	var timer *time.Timer
+	var expire <-chan time.Time
+	if !deadline.IsZero() {
+		timer = time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expire = timer.C
+	}
+	select {
+	case msg := <-ch:
+		n = copy(buff, msg)
+	case <-done:
+		err = errTransportClosed
+	case <-expire:
+		err = errTransportTimeout
+	}
+	return
+}
+
+// streamTransport datagrams over a byte stream, each one prefixed with its
+// length as big endian word
+type streamTransport struct {
+	rw    io.ReadWriteCloser
+	name  string
+	wlock sync.Mutex
+	in    chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewStreamTransport return a transport framing datagrams on a byte stream
+// like a serial line, a TCP connection or a Unix socket. Each datagram is
+// sent as a big endian word holding its length followed by its bytes.
+func NewStreamTransport(rw io.ReadWriteCloser, name string) Transport {
+	var t = &streamTransport{
+		rw:   rw,
+		name: name,
+		in:   make(chan []byte, 64),
+		done: make(chan struct{}),
+	}
+	go t.readLoop()
+	return t
+}
+
+// DialStream open a framed stream transport. address is "tcp:host:port",
+// "unix:/path/to/socket" or the path of a device file like /dev/ttyS0.
+func DialStream(address string) (t Transport, err error) {
+	var rw io.ReadWriteCloser
+	switch {
+	case strings.HasPrefix(address, "tcp:"):
+		rw, err = net.Dial("tcp", address[len("tcp:"):])
+	case strings.HasPrefix(address, "unix:"):
+		rw, err = net.Dial("unix", address[len("unix:"):])
+	default:
+		rw, err = os.OpenFile(address, os.O_RDWR, 0)
+	}
+	if err != nil {
+		return
+	}
+	t = NewStreamTransport(rw, address)
+	return
+}
+
+func (t *streamTransport) readLoop() {
+	var head = make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(t.rw, head); err != nil {
+			t.Close()
+			return
+		}
+		var msg = make([]byte, binary.BigEndian.Uint16(head))
+		if _, err := io.ReadFull(t.rw, msg); err != nil {
+			t.Close()
+			return
+		}
+		select {
+		case t.in <- msg:
+		case <-t.done:
+			return
+		default:
+			// receiver too slow, drop like a datagram network
+		}
+	}
+}
+
+func (t *streamTransport) Send(buff []byte) (err error) {
+	var frame = make([]byte, 2, 2+len(buff))
+	if len(buff) > 0xffff {
+		return newOpError("datagram too long for stream")
+	}
+	binary.BigEndian.PutUint16(frame, uint16(len(buff)))
+	frame = append(frame, buff...)
+	t.wlock.Lock()
+	defer t.wlock.Unlock()
+	_, err = t.rw.Write(frame)
+	return
+}
+
+func (t *streamTransport) Receive(buff []byte, deadline time.Time) (n int, err error) {
+	return receiveChan(t.in, t.done, buff, deadline)
+}
+
+func (t *streamTransport) Close() (err error) {
+	t.once.Do(func() {
+		close(t.done)
+		err = t.rw.Close()
+	})
+	return
+}
+
+func (t *streamTransport) String() string {
+	return t.name
+}
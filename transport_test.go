@@ -0,0 +1,152 @@
+package fsp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestStreamFraming(t *testing.T) {
+	var a, b = net.Pipe()
+	var tr = fsp.NewStreamTransport(a, "pipe")
+	defer tr.Close()
+	defer b.Close()
+
+	go tr.Send([]byte("hello"))
+	var frame = make([]byte, 7)
+	if _, err := io.ReadFull(b, frame); err != nil || string(frame) != "\x00\x05hello" {
+		t.Fatalf("got frame %q, %v", frame, err)
+	}
+
+	// two frames in one write, then one frame split over two writes
+	go func() {
+		b.Write([]byte("\x00\x03one\x00\x03two"))
+		b.Write([]byte("\x00\x05th"))
+		b.Write([]byte("ree"))
+	}()
+	var buff = make([]byte, fsp.FSPMaxPacket)
+	for _, want := range []string{"one", "two", "three"} {
+		n, err := tr.Receive(buff, time.Now().Add(5*time.Second))
+		if err != nil || string(buff[:n]) != want {
+			t.Fatalf("got %q, %v, want %q", buff[:n], err, want)
+		}
+	}
+}
+
+func TestStreamOversize(t *testing.T) {
+	var a, b = net.Pipe()
+	var tr = fsp.NewStreamTransport(a, "pipe")
+	defer tr.Close()
+	defer b.Close()
+	if err := tr.Send(make([]byte, 0x10000)); err == nil {
+		t.Error("datagram over 64 KiB sent")
+	}
+
+	// the largest frame still pass
+	var big = bytes.Repeat([]byte{0xa5}, 0xffff)
+	go b.Write(append([]byte{0xff, 0xff}, big...))
+	var buff = make([]byte, len(big))
+	n, err := tr.Receive(buff, time.Now().Add(5*time.Second))
+	if err != nil || !bytes.Equal(buff[:n], big) {
+		t.Errorf("got %d bytes, %v", n, err)
+	}
+}
+
+func TestStreamReceiveTimeout(t *testing.T) {
+	var a, b = net.Pipe()
+	var tr = fsp.NewStreamTransport(a, "pipe")
+	defer tr.Close()
+	defer b.Close()
+	var start = time.Now()
+	_, err := tr.Receive(make([]byte, 16), start.Add(50*time.Millisecond))
+	if !errors.Is(err, fsp.ErrTimeout) || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	for _, side := range []string{"local", "remote"} {
+		var a, b = net.Pipe()
+		var tr = fsp.NewStreamTransport(a, "pipe")
+		var errc = make(chan error, 1)
+		go func() {
+			var _, err = tr.Receive(make([]byte, 16), time.Time{})
+			errc <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		if side == "local" {
+			tr.Close()
+		} else {
+			b.Close()
+		}
+		select {
+		case err := <-errc:
+			if err == nil || errors.Is(err, fsp.ErrTimeout) {
+				t.Errorf("%s close got %v", side, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s close did not stop Receive", side)
+		}
+		if err := tr.Send([]byte("late")); err == nil {
+			t.Errorf("%s close, send succeeded", side)
+		}
+		tr.Close()
+		b.Close()
+	}
+}
+
+func TestStreamSession(t *testing.T) {
+	var srv, _ = startServer(t)
+	var a, b = net.Pipe()
+	var server = fsp.NewStreamTransport(b, "stream server")
+	go srv.Serve(server)
+	defer server.Close()
+	var data = testData(5000)
+	srv.WriteFile("/dev.bin", data, time.Now())
+	s, err := fsp.NewSessionWithTransport(fsp.NewStreamTransport(a, "stream client"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var buff bytes.Buffer
+	if _, err = s.Download(context.Background(), "/dev.bin", &buff); err != nil || !bytes.Equal(buff.Bytes(), data) {
+		t.Errorf("got %d bytes, %v", buff.Len(), err)
+	}
+}
+
+func TestDialStream(t *testing.T) {
+	var srv, _ = startServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			srv.Serve(fsp.NewStreamTransport(conn, "tcp server"))
+		}
+	}()
+	tr, err := fsp.DialStream("tcp:" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fsp.NewSessionWithTransport(tr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	srv.Mkdir("/tcp")
+	if fi, err := s.Stat("/tcp"); err != nil || !fi.IsDir() {
+		t.Errorf("got %v, %v", fi, err)
+	}
+	if _, err = fsp.DialStream(t.TempDir() + "/ttyMissing"); err == nil {
+		t.Error("missing device opened")
+	}
+}
@@ -0,0 +1,127 @@
+package fsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// UploadOptions options of Upload, the zero value is usable
+type UploadOptions struct {
+	ModTime   time.Time // timestamp sent with CC_INSTALL, now if zero
+	RateLimit int64     // bytes per second of this upload on top of the session limit, 0 no limit
+	Atomic    bool      // upload to a hidden temporary name, then rename it into place
+}
+
+// SetAtomicUpload make UploadFile upload to a hidden temporary name in the
+// same directory and rename it into place, see UploadOptions.Atomic
+func (s *Session) SetAtomicUpload(atomic bool) {
+	s.atomic = atomic
+}
+
+// Upload stream r to remotePath, the file is installed when r return
+// io.EOF. When r, ctx or the server fail the upload is cancelled and no file
+// is installed. n is the number of bytes read from r.
+//
+// With opts.Atomic readers of the directory never see a partial file, the
+// data is installed under a hidden temporary name which is renamed to
+// remotePath at the end and removed on failure. When the server refuse to
+// rename over an existing file, the old file is removed before a second
+// rename, so the replace is not atomic and remotePath is missing for a
+// moment. If that second rename fail the temporary file is kept and named
+// in the error, as it hold the only copy of the data.
+func (s *Session) Upload(ctx context.Context, remotePath string, r io.Reader, opts *UploadOptions) (n int64, err error) {
+	var tmpPath string
+	if opts == nil || !opts.Atomic {
+		return s.upload(ctx, remotePath, r, opts)
+	}
+	tmpPath = s.tempName(remotePath)
+	n, err = s.upload(ctx, tmpPath, r, opts)
+	if err != nil {
+		return
+	}
+	err = s.Rename(tmpPath, remotePath)
+	if errors.Is(err, ErrExist) {
+		// server refuse to replace, remove the old file first
+		if err = s.Remove(remotePath); err == nil {
+			if err = s.Rename(tmpPath, remotePath); err != nil {
+				err = &fspError{Cmd: FSPCommandRename, Err: err,
+					Reason: fmt.Sprintf("old %s removed but rename fail, upload kept as %s: %v", remotePath, tmpPath, err)}
+				return
+			}
+		}
+	}
+	if err != nil {
+		if rmErr := s.Remove(tmpPath); rmErr != nil {
+			s.verbose(0, "remove temporary %s fail, %v", tmpPath, rmErr)
+		}
+	}
+	return
+}
+
+// tempName hidden temporary name in the directory of remotePath
+func (s *Session) tempName(remotePath string) string {
+	var dirName, fileName = path.Split(remotePath)
+	return dirName + fmt.Sprintf(".%s.%04x.tmp", fileName, s.randUint16())
+}
+
+// upload stream r to remotePath, see Upload
+func (s *Session) upload(ctx context.Context, remotePath string, r io.Reader, opts *UploadOptions) (n int64, err error) {
+	var fspFile *File
+	var buff []byte
+	var done int
+	var readErr error
+	var modTime time.Time
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	modTime = opts.ModTime
+	fspFile, err = s.openFile(remotePath, "w")
+	if err != nil {
+		return
+	}
+	fspFile.SetRateLimit(opts.RateLimit)
+	buff = make([]byte, FSPSpace)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		done, readErr = r.Read(buff)
+		if done > 0 {
+			err = fspFile.Write(buff[:done])
+			if err != nil {
+				break
+			}
+			n += int64(done)
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			err = &fspError{Cmd: FSPCommandUpload, Err: readErr}
+			break
+		}
+	}
+	if err == nil {
+		err = fspFile.Flush()
+	}
+	if err == nil {
+		if modTime.IsZero() {
+			modTime = time.Now()
+		}
+		err = fspFile.install(modTime.Unix())
+	}
+	if err != nil {
+		if abortErr := fspFile.abort(); abortErr != nil {
+			s.verbose(0, "cancel upload %s fail, %v", remotePath, abortErr)
+		}
+		return
+	}
+	s.verbose(0, "upload %s done, %d bytes", remotePath, n)
+	return
+}
@@ -0,0 +1,198 @@
+package fsp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// failReader return its data, then err
+type failReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failReader) Read(p []byte) (n int, err error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n = copy(p, r.data)
+	r.data = r.data[n:]
+	return
+}
+
+func TestUpload(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = testData(5000)
+	var modTime = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	n, err := s.Upload(context.Background(), "/up.bin", bytes.NewReader(data), &fsp.UploadOptions{ModTime: modTime})
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("upload %d bytes, %v", n, err)
+	}
+	if got, err := srv.ReadFile("/up.bin"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("server got %d bytes, %v", len(got), err)
+	}
+	if fi, err := s.Stat("/up.bin"); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Errorf("remote mtime %v, %v, want %v", fi.ModTime(), err, modTime)
+	}
+}
+
+func TestUploadReaderFailure(t *testing.T) {
+	var srv, s = startServer(t)
+	var readErr = errors.New("disk on fire")
+	var r = &failReader{data: testData(3000), err: readErr}
+	n, err := s.Upload(context.Background(), "/broken.bin", r, nil)
+	if !errors.Is(err, readErr) {
+		t.Fatalf("got %v, want the reader error", err)
+	}
+	if n != 3000 {
+		t.Errorf("read %d bytes, want 3000", n)
+	}
+	if srv.Exists("/broken.bin") {
+		t.Error("failed upload installed")
+	}
+}
+
+func TestUploadCancel(t *testing.T) {
+	var srv, s = startServer(t)
+	var ctx, cancel = context.WithCancel(context.Background())
+	var pr, pw = io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.Write(testData(2000))
+		cancel()
+		pw.Write(testData(2000))
+		pw.Close()
+	}()
+	_, err := s.Upload(ctx, "/cancelled.bin", pr, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if srv.Exists("/cancelled.bin") {
+		t.Error("cancelled upload installed")
+	}
+}
+
+// remoteNames return the names in dir without "." and ".."
+func remoteNames(t *testing.T, s *fsp.Session, dir string) (names []string) {
+	t.Helper()
+	list, err := s.Readdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range list {
+		if fi.Name() != "." && fi.Name() != ".." {
+			names = append(names, fi.Name())
+		}
+	}
+	return
+}
+
+func TestUploadFileTime(t *testing.T) {
+	var srv, s = startServer(t)
+	var local = filepath.Join(t.TempDir(), "old.txt")
+	var old = time.Now().Add(-48 * time.Hour)
+	os.WriteFile(local, []byte("old data"), 0644)
+	os.Chtimes(local, old, old)
+	srv.Mkdir("/pub")
+	if err := s.UploadFile(local, "/pub/"); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := s.Stat("/pub/old.txt")
+	if err != nil || time.Since(fi.ModTime()) > time.Minute {
+		t.Errorf("got mtime %v, %v, want the upload time", fi.ModTime(), err)
+	}
+	if _, err = s.Upload(context.Background(), "/pub/kept.txt", bytes.NewReader([]byte("x")), &fsp.UploadOptions{ModTime: old}); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = s.Stat("/pub/kept.txt"); err != nil || fi.ModTime().Unix() != old.Unix() {
+		t.Errorf("got mtime %v, %v, want %v", fi.ModTime(), err, old)
+	}
+}
+
+func TestAtomicUpload(t *testing.T) {
+	var srv, s = startServer(t)
+	var opts = &fsp.UploadOptions{Atomic: true}
+	srv.WriteFile("/pub/f.txt", []byte("old content"), time.Now())
+	_, err := s.Upload(context.Background(), "/pub/f.txt", bytes.NewReader([]byte("new")), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.ReadFile("/pub/f.txt"); string(got) != "new" {
+		t.Errorf("got %q after atomic replace", got)
+	}
+
+	var r = &failReader{data: testData(2000), err: errors.New("read fail")}
+	if _, err = s.Upload(context.Background(), "/pub/g.txt", r, opts); err == nil {
+		t.Fatal("no error for failing reader")
+	}
+	if names := remoteNames(t, s, "/pub"); len(names) != 1 || names[0] != "f.txt" {
+		t.Errorf("got %v after failed atomic upload, want only f.txt", names)
+	}
+}
+
+func TestAtomicUploadNoReplace(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.SetNoReplace(true)
+	srv.WriteFile("/pub/f.txt", []byte("old content"), time.Now())
+	_, err := s.Upload(context.Background(), "/pub/f.txt", bytes.NewReader([]byte("new")), &fsp.UploadOptions{Atomic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.ReadFile("/pub/f.txt"); string(got) != "new" {
+		t.Errorf("got %q after replace by remove and rename", got)
+	}
+	if names := remoteNames(t, s, "/pub"); len(names) != 1 {
+		t.Errorf("got %v, temporary file left", names)
+	}
+}
+
+func TestAtomicUploadKeepTemporary(t *testing.T) {
+	var renames int
+	var removed []string
+	var s = pipeSession(t, func(req *fsp.Packet) *fsp.Packet {
+		switch req.Cmd {
+		case fsp.FSPCommandRename:
+			renames++
+			if renames == 1 {
+				return &fsp.Packet{Cmd: fsp.FSPCommandErr, Data: []byte("file exists\x00")}
+			}
+			return &fsp.Packet{Cmd: fsp.FSPCommandErr, Data: []byte("permission denied\x00")}
+		case fsp.FSPCommandDelFile:
+			removed = append(removed, string(bytes.TrimRight(req.Data, "\x00")))
+		}
+		return &fsp.Packet{Cmd: req.Cmd, Pos: req.Pos}
+	})
+	_, err := s.Upload(context.Background(), "/pub/f.txt", bytes.NewReader([]byte("new")), &fsp.UploadOptions{Atomic: true})
+	if !errors.Is(err, fsp.ErrPermission) || !strings.Contains(err.Error(), "/pub/.f.txt.") {
+		t.Errorf("got %v, want the error naming the temporary file", err)
+	}
+	if len(removed) != 1 || removed[0] != "/pub/f.txt" {
+		t.Errorf("removed %v, want only the old file", removed)
+	}
+}
+
+func TestAtomicUploadFile(t *testing.T) {
+	var srv, s = startServer(t)
+	var local = filepath.Join(t.TempDir(), "local.txt")
+	os.WriteFile(local, []byte("local data"), 0644)
+	srv.Mkdir("/pub")
+	s.SetAtomicUpload(true)
+	if err := s.UploadFile(local, "/pub/local.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.ReadFile("/pub/local.txt"); string(got) != "local data" {
+		t.Errorf("got %q", got)
+	}
+	if names := remoteNames(t, s, "/pub"); len(names) != 1 {
+		t.Errorf("got %v, temporary file left", names)
+	}
+}
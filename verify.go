@@ -0,0 +1,175 @@
+package fsp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Verify select the checks done after a file is downloaded
+type Verify uint8
+
+// download verification checks
+const (
+	VerifySize    Verify = 1 << iota // downloaded bytes equal the size reported by Stat
+	VerifyModTime                    // remote file not changed while downloading
+	VerifySHA256                     // compare with sidecar file name.sha256 when present
+	VerifyMD5                        // compare with sidecar file name.md5 when present
+
+	VerifyDefault = VerifySize | VerifyModTime
+)
+
+// VerifyError is returned when a downloaded file fail a verification check
+type VerifyError struct {
+	Path  string // remote file path
+	Check string // "size", "mtime", "sha256" or "md5"
+	Want  string // expected value
+	Got   string // value of the download
+}
+
+// Is make checksum mismatch match ErrChecksum
+func (e *VerifyError) Is(target error) bool {
+	return target == ErrChecksum && (e.Check == "sha256" || e.Check == "md5")
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify %s fail, %s want %s, got %s", e.Path, e.Check, e.Want, e.Got)
+}
+
+// SetVerify set the checks done after each download, 0 disable verification
+func (s *Session) SetVerify(v Verify) {
+	s.verify = v
+}
+
+// SetPreserveTimes set whether downloaded files get the modification time
+// of the remote file, it is enabled by default
+func (s *Session) SetPreserveTimes(keep bool) {
+	s.keepTimes = keep
+}
+
+// SetSkipUnchanged set whether a download is skipped when the local file
+// already has the size and modification time of the remote file
+func (s *Session) SetSkipUnchanged(skip bool) {
+	s.skipSame = skip
+}
+
+// downloadSums hash writers fed while downloading
+type downloadSums struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func (s *Session) newDownloadSums() (sums downloadSums) {
+	if s.verify&VerifySHA256 != 0 {
+		sums.sha256 = sha256.New()
+	}
+	if s.verify&VerifyMD5 != 0 {
+		sums.md5 = md5.New()
+	}
+	return
+}
+
+// writer wrap w so that written data is also hashed
+func (sums downloadSums) writer(w io.Writer) io.Writer {
+	var writers = []io.Writer{w}
+	if sums.sha256 != nil {
+		writers = append(writers, sums.sha256)
+	}
+	if sums.md5 != nil {
+		writers = append(writers, sums.md5)
+	}
+	if len(writers) == 1 {
+		return w
+	}
+	return io.MultiWriter(writers...)
+}
+
+// verifyDownload check a finished download against the stat taken before it
+func (s *Session) verifyDownload(remotePath string, before os.FileInfo, written int64, sums downloadSums) (err error) {
+	var after os.FileInfo
+	if before == nil {
+		return
+	}
+	if s.verify&VerifySize != 0 && written != before.Size() {
+		return &VerifyError{Path: remotePath, Check: "size",
+			Want: fmt.Sprintf("%d", before.Size()), Got: fmt.Sprintf("%d", written)}
+	}
+	if s.verify&VerifyModTime != 0 {
+		// a cached result would hide changes made while downloading
+		s.cache.drop(cacheStat, remotePath)
+		after, err = s.Stat(remotePath)
+		if err != nil {
+			return
+		}
+		if !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+			return &VerifyError{Path: remotePath, Check: "mtime",
+				Want: before.ModTime().String(), Got: after.ModTime().String()}
+		}
+	}
+	if sums.sha256 != nil {
+		if err = s.verifySidecar(remotePath, "sha256", sums.sha256); err != nil {
+			return
+		}
+	}
+	if sums.md5 != nil {
+		err = s.verifySidecar(remotePath, "md5", sums.md5)
+	}
+	return
+}
+
+// verifySidecar compare sum with the first word of the remote file
+// remotePath.ext, a missing sidecar file is not an error but any other
+// failure to stat it is
+func (s *Session) verifySidecar(remotePath, ext string, sum hash.Hash) (err error) {
+	var sidecar = remotePath + "." + ext
+	var buff bytes.Buffer
+	var fields []string
+	var got = hex.EncodeToString(sum.Sum(nil))
+	if _, err = s.Stat(sidecar); errors.Is(err, ErrNotExist) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	if err = s.readAll(sidecar, &buff); err != nil {
+		return
+	}
+	fields = strings.Fields(buff.String())
+	if len(fields) == 0 || !strings.EqualFold(fields[0], got) {
+		var want string
+		if len(fields) > 0 {
+			want = fields[0]
+		}
+		return &VerifyError{Path: remotePath, Check: ext, Want: want, Got: got}
+	}
+	return
+}
+
+// readAll copy remote file content into w
+func (s *Session) readAll(remotePath string, w io.Writer) (err error) {
+	var fspFile *File
+	var buff = make([]byte, FSPSpace)
+	var done int
+	fspFile, err = s.openFile(remotePath, "rb")
+	if err != nil {
+		return
+	}
+	defer fspFile.Close()
+	for {
+		done, err = fspFile.Read(buff, 1, 1024)
+		if err != nil || done <= 0 {
+			break
+		}
+		if _, err = w.Write(buff[:done]); err != nil {
+			break
+		}
+	}
+	return
+}
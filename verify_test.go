@@ -0,0 +1,102 @@
+package fsp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+func TestVerifySidecar(t *testing.T) {
+	var srv, s = startServer(t)
+	var data = bytes.Repeat([]byte("checked data "), 200)
+	var sha = sha256.Sum256(data)
+	var sum = md5.Sum(data)
+	srv.WriteFile("/good.bin", data, time.Now())
+	srv.WriteFile("/good.bin.sha256", []byte(hex.EncodeToString(sha[:])+"  good.bin\n"), time.Now())
+	srv.WriteFile("/bad.bin", data, time.Now())
+	srv.WriteFile("/bad.bin.md5", []byte("0123456789abcdef0123456789abcdef  bad.bin\n"), time.Now())
+	srv.WriteFile("/plain.bin", data, time.Now())
+	s.SetVerify(fsp.VerifyDefault | fsp.VerifySHA256 | fsp.VerifyMD5)
+
+	for _, name := range []string{"/good.bin", "/plain.bin"} {
+		var buff bytes.Buffer
+		n, err := s.Download(context.Background(), name, &buff)
+		if err != nil || n != int64(len(data)) || !bytes.Equal(buff.Bytes(), data) {
+			t.Errorf("%s: got %d bytes, %v", name, n, err)
+		}
+	}
+
+	var buff bytes.Buffer
+	var verr *fsp.VerifyError
+	_, err := s.Download(context.Background(), "/bad.bin", &buff)
+	if !errors.Is(err, fsp.ErrChecksum) || !errors.As(err, &verr) {
+		t.Fatalf("got %v, want checksum error", err)
+	}
+	if verr.Check != "md5" || verr.Got != hex.EncodeToString(sum[:]) {
+		t.Errorf("got check %s sum %s", verr.Check, verr.Got)
+	}
+}
+
+func TestPreserveTimesAndSkipUnchanged(t *testing.T) {
+	var srv, s = startServer(t)
+	var modTime = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	var local = filepath.Join(t.TempDir(), "f.txt")
+	srv.WriteFile("/f.txt", []byte("remote"), modTime)
+	if err := s.DwonloadFile("/f.txt", local, 0); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(local)
+	if err != nil || !fi.ModTime().Equal(modTime) {
+		t.Fatalf("local mtime %v, %v, want %v", fi.ModTime(), err, modTime)
+	}
+
+	// same size and mtime, the local content is kept
+	os.WriteFile(local, []byte("LOCAL!"), 0644)
+	os.Chtimes(local, modTime, modTime)
+	s.SetSkipUnchanged(true)
+	if err = s.DwonloadFile("/f.txt", local, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "LOCAL!" {
+		t.Errorf("unchanged file downloaded again, got %q", data)
+	}
+
+	srv.WriteFile("/f.txt", []byte("remote"), modTime.Add(time.Hour))
+	if err = s.DwonloadFile("/f.txt", local, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "remote" {
+		t.Errorf("changed file not downloaded, got %q", data)
+	}
+}
+
+func TestVerifySidecarStatError(t *testing.T) {
+	var data = []byte("abcd")
+	var s = pipeSession(t, func(req *fsp.Packet) *fsp.Packet {
+		var name = string(bytes.TrimRight(req.Data, "\x00"))
+		switch {
+		case req.Cmd == fsp.FSPCommandStat && name == "/f.bin":
+			// time, size 4 and type file
+			return &fsp.Packet{Cmd: req.Cmd, Data: []byte{0, 0, 0, 1, 0, 0, 0, 4, 1}}
+		case req.Cmd == fsp.FSPCommandGetFile && req.Pos < uint32(len(data)):
+			return &fsp.Packet{Cmd: req.Cmd, Pos: req.Pos, Data: data[req.Pos:]}
+		case req.Cmd == fsp.FSPCommandGetFile:
+			return &fsp.Packet{Cmd: req.Cmd, Pos: req.Pos}
+		}
+		return &fsp.Packet{Cmd: fsp.FSPCommandErr, Data: []byte("permission denied\x00")}
+	})
+	s.SetVerify(fsp.VerifyDefault | fsp.VerifySHA256)
+	var buff bytes.Buffer
+	if _, err := s.Download(context.Background(), "/f.bin", &buff); !errors.Is(err, fsp.ErrPermission) {
+		t.Errorf("got %v, want the sidecar stat error", err)
+	}
+}
@@ -0,0 +1,177 @@
+package fsp
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// SetWalkWorkers set the number of sessions listing directories in parallel
+// during Walk and WalkDir, the callback is still called from one goroutine in
+// lexical order. Below 2 directories are listed one at a time.
+func (s *Session) SetWalkWorkers(workers int) {
+	s.walkWorkers = workers
+}
+
+// WalkDir walk the remote tree rooted at root like filepath.WalkDir, calling
+// fn for each file or directory including root. Entries are visited in
+// lexical order, fn may return fs.SkipDir or fs.SkipAll. When a directory
+// can not be listed fn is called a second time for it with the error.
+func (s *Session) WalkDir(root string, fn fs.WalkDirFunc) (err error) {
+	var info os.FileInfo
+	var w = &walker{s: s, fn: fn}
+	info, err = s.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		w.start()
+		err = w.walk(root, fs.FileInfoToDirEntry(info))
+		w.stop()
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		err = nil
+	}
+	return
+}
+
+// Walk walk the remote tree rooted at root like filepath.Walk, see WalkDir
+func (s *Session) Walk(root string, fn filepath.WalkFunc) error {
+	return s.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		var info os.FileInfo
+		if d != nil {
+			info, _ = d.Info()
+		}
+		return fn(name, info, err)
+	})
+}
+
+// readDirSorted entries of dirName without "." and "..", sorted by name
+func (s *Session) readDirSorted(dirName string) (entries []os.FileInfo, err error) {
+	var all []os.FileInfo
+	all, err = s.Readdir(dirName)
+	for _, fi := range all {
+		if fi.Name() != "." && fi.Name() != ".." {
+			entries = append(entries, fi)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return
+}
+
+// walker state of one WalkDir, with workers subdirectories are listed ahead
+// of the walk by forked sessions
+type walker struct {
+	s        *Session
+	fn       fs.WalkDirFunc
+	sessions chan *Session           // idle sessions, nil without workers
+	forks    []*Session              // sessions to close at the end
+	pending  map[string]*walkListing // listings ahead of the walk
+	wg       sync.WaitGroup
+	done     int32 // set when the walk ended, pending listings are dropped
+}
+
+// walkListing result of a listing done ahead of the walk
+type walkListing struct {
+	ready   chan struct{}
+	entries []os.FileInfo
+	err     error
+}
+
+func (w *walker) start() {
+	if w.s.walkWorkers < 2 {
+		return
+	}
+	w.pending = make(map[string]*walkListing)
+	w.sessions = make(chan *Session, w.s.walkWorkers)
+	w.sessions <- w.s
+	for i := 1; i < w.s.walkWorkers; i++ {
+		sess, err := w.s.fork()
+		if err != nil {
+			w.s.verbose(0, "open walk session fail, %v", err)
+			break
+		}
+		w.forks = append(w.forks, sess)
+		w.sessions <- sess
+	}
+}
+
+func (w *walker) stop() {
+	atomic.StoreInt32(&w.done, 1)
+	w.wg.Wait()
+	for _, sess := range w.forks {
+		sess.Close()
+	}
+}
+
+// prefetch list dirName in background
+func (w *walker) prefetch(dirName string) {
+	var l = &walkListing{ready: make(chan struct{})}
+	if w.sessions == nil {
+		return
+	}
+	w.pending[dirName] = l
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(l.ready)
+		var sess = <-w.sessions
+		if atomic.LoadInt32(&w.done) == 0 {
+			l.entries, l.err = sess.readDirSorted(dirName)
+		}
+		w.sessions <- sess
+	}()
+}
+
+func (w *walker) readDir(dirName string) (entries []os.FileInfo, err error) {
+	var l = w.pending[dirName]
+	if l == nil {
+		return w.s.readDirSorted(dirName)
+	}
+	delete(w.pending, dirName)
+	<-l.ready
+	return l.entries, l.err
+}
+
+// walk call fn for name and, if it is a directory, everything below it
+func (w *walker) walk(name string, d fs.DirEntry) (err error) {
+	var entries []os.FileInfo
+	err = w.fn(name, d, nil)
+	if err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return
+	}
+	entries, err = w.readDir(name)
+	if err != nil {
+		err = w.fn(name, d, err)
+		if err == fs.SkipDir {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	for _, fi := range entries {
+		if fi.IsDir() {
+			w.prefetch(path.Join(name, fi.Name()))
+		}
+	}
+	for _, fi := range entries {
+		err = w.walk(path.Join(name, fi.Name()), fs.FileInfoToDirEntry(fi))
+		if err != nil {
+			if err == fs.SkipDir {
+				err = nil
+				break
+			}
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package fsp_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+	"github.com/finove/fsp/fsptest"
+)
+
+// walkTree create a small tree below /w
+func walkTree(srv *fsptest.Server) {
+	for _, name := range []string{"/w/b/2.txt", "/w/a/1.txt", "/w/a/sub/x.txt", "/w/c.txt", "/w/d/y.txt"} {
+		srv.WriteFile(name, []byte(name), time.Now())
+	}
+}
+
+// walkNames return the names visited by WalkDir, fn can change the walk
+func walkNames(t *testing.T, s *fsp.Session, root string, fn func(name string, d fs.DirEntry) error) (names []string, err error) {
+	err = s.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		if fn != nil {
+			return fn(name, d)
+		}
+		return nil
+	})
+	return
+}
+
+func TestWalkDir(t *testing.T) {
+	var srv, s = startServer(t)
+	walkTree(srv)
+	var want = "/w /w/a /w/a/1.txt /w/a/sub /w/a/sub/x.txt /w/b /w/b/2.txt /w/c.txt /w/d /w/d/y.txt"
+	for _, workers := range []int{1, 3} {
+		s.SetWalkWorkers(workers)
+		names, err := walkNames(t, s, "/w", nil)
+		if err != nil || strings.Join(names, " ") != want {
+			t.Errorf("workers %d: got %v, %v", workers, names, err)
+		}
+	}
+}
+
+func TestWalkDirSkip(t *testing.T) {
+	var srv, s = startServer(t)
+	walkTree(srv)
+	s.SetWalkWorkers(2)
+	names, err := walkNames(t, s, "/w", func(name string, d fs.DirEntry) error {
+		if name == "/w/a" {
+			return fs.SkipDir
+		}
+		if name == "/w/b/2.txt" {
+			// SkipDir on a file skip the rest of its directory
+			return fs.SkipDir
+		}
+		if name == "/w/d" {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || strings.Join(names, " ") != "/w /w/a /w/b /w/b/2.txt /w/c.txt /w/d" {
+		t.Errorf("got %v, %v", names, err)
+	}
+}
+
+func TestWalkMissingRoot(t *testing.T) {
+	var _, s = startServer(t)
+	var stop = errors.New("stop")
+	var calls int
+	err := s.Walk("/none", func(name string, info os.FileInfo, err error) error {
+		calls++
+		if !errors.Is(err, fsp.ErrNotExist) || info != nil {
+			t.Errorf("got %v, %v", info, err)
+		}
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+}
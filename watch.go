@@ -0,0 +1,208 @@
+package fsp
+
+import (
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WatchOp kind of change reported by a Watcher
+type WatchOp int
+
+// watch operations
+const (
+	WatchCreate WatchOp = iota + 1
+	WatchModify
+	WatchDelete
+)
+
+func (op WatchOp) String() string {
+	switch op {
+	case WatchCreate:
+		return "create"
+	case WatchModify:
+		return "modify"
+	case WatchDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// WatchEvent one change of a watched directory
+type WatchEvent struct {
+	Op   WatchOp
+	Name string      // remote path
+	Info os.FileInfo // entry after the change, last known entry on delete
+}
+
+// Watcher poll a remote directory and report changes, see Session.Watch
+type Watcher struct {
+	Events chan WatchEvent // changes, closed by Close
+	Errors chan error      // listing errors, dropped when nobody read them
+
+	s        *Session
+	dir      string
+	interval time.Duration
+	mu       sync.Mutex
+	stable   time.Duration
+	known    map[string]*watchState
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// watchState what the watcher know about one entry
+type watchState struct {
+	fi       os.FileInfo
+	changed  time.Time // last time size or modification time changed
+	reported bool      // a create event was sent
+	pending  bool      // change not reported yet
+}
+
+// Watch poll dir every interval and send an event for each entry created,
+// modified or deleted since the previous listing. Entries present at start
+// are not reported. A new or changed file is reported only after its size
+// and modification time stayed the same for the stability window, one
+// interval by default, so files still being uploaded are not seen half
+// written.
+func (s *Session) Watch(dir string, interval time.Duration) (w *Watcher, err error) {
+	var entries []os.FileInfo
+	if interval <= 0 {
+		interval = time.Second
+	}
+	w = &Watcher{
+		Events:   make(chan WatchEvent, 64),
+		Errors:   make(chan error, 1),
+		s:        s,
+		dir:      dir,
+		interval: interval,
+		stable:   interval,
+		known:    make(map[string]*watchState),
+		done:     make(chan struct{}),
+	}
+	entries, err = w.list()
+	if err != nil {
+		w = nil
+		return
+	}
+	for _, fi := range entries {
+		w.known[fi.Name()] = &watchState{fi: fi, reported: true}
+	}
+	w.wg.Add(1)
+	go w.run()
+	return
+}
+
+// SetStability set how long a new or changed file must stay unchanged
+// before it is reported, 0 report changes at the next poll
+func (w *Watcher) SetStability(window time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stable = window
+}
+
+// Close stop polling and close the channels
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	w.wg.Wait()
+	close(w.Events)
+	close(w.Errors)
+	return nil
+}
+
+// list read the directory bypassing the session cache
+func (w *Watcher) list() (entries []os.FileInfo, err error) {
+	var all []os.FileInfo
+	w.s.cache.drop(cacheDir, w.dir)
+	all, err = w.s.Readdir(w.dir)
+	for _, fi := range all {
+		if fi.Name() != "." && fi.Name() != ".." {
+			entries = append(entries, fi)
+		}
+	}
+	return
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	var ticker = time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		if !w.poll() {
+			return
+		}
+	}
+}
+
+// poll compare a new listing with the known entries and send events, false
+// when the watcher is closed
+func (w *Watcher) poll() bool {
+	var entries, err = w.list()
+	var now = time.Now()
+	var seen = make(map[string]bool)
+	var events []WatchEvent
+	if err != nil {
+		select {
+		case w.Errors <- err:
+		default:
+		}
+		return true
+	}
+	w.mu.Lock()
+	var stable = w.stable
+	w.mu.Unlock()
+	for _, fi := range entries {
+		var name = fi.Name()
+		var st = w.known[name]
+		seen[name] = true
+		if st == nil {
+			st = &watchState{fi: fi, changed: now, pending: true}
+			w.known[name] = st
+		} else if st.fi.Size() != fi.Size() || !st.fi.ModTime().Equal(fi.ModTime()) || st.fi.IsDir() != fi.IsDir() {
+			st.fi = fi
+			st.changed = now
+			st.pending = true
+		}
+		if st.pending && now.Sub(st.changed) >= stable {
+			var op = WatchModify
+			if !st.reported {
+				op = WatchCreate
+			}
+			st.pending = false
+			st.reported = true
+			events = append(events, WatchEvent{Op: op, Name: path.Join(w.dir, name), Info: fi})
+		}
+	}
+	var gone []string
+	for name := range w.known {
+		if !seen[name] {
+			gone = append(gone, name)
+		}
+	}
+	sort.Strings(gone)
+	for _, name := range gone {
+		if st := w.known[name]; st.reported {
+			events = append(events, WatchEvent{Op: WatchDelete, Name: path.Join(w.dir, name), Info: st.fi})
+		}
+		delete(w.known, name)
+	}
+	for _, ev := range events {
+		select {
+		case w.Events <- ev:
+		case <-w.done:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package fsp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/finove/fsp"
+)
+
+// nextEvent wait for the next watcher event
+func nextEvent(t *testing.T, w *fsp.Watcher) (ev fsp.WatchEvent) {
+	t.Helper()
+	select {
+	case ev = <-w.Events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch event")
+	}
+	return
+}
+
+func TestWatch(t *testing.T) {
+	var srv, s = startServer(t)
+	var modTime = time.Now().Add(-time.Hour)
+	srv.WriteFile("/w/old.txt", []byte("old"), modTime)
+	w, err := s.Watch("/w", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetStability(0)
+	srv.WriteFile("/w/new.txt", []byte("new"), modTime)
+	if ev := nextEvent(t, w); ev.Op != fsp.WatchCreate || ev.Name != "/w/new.txt" || ev.Info.Size() != 3 {
+		t.Errorf("got %v %s", ev.Op, ev.Name)
+	}
+	srv.WriteFile("/w/old.txt", []byte("changed"), modTime)
+	if ev := nextEvent(t, w); ev.Op != fsp.WatchModify || ev.Name != "/w/old.txt" || ev.Info.Size() != 7 {
+		t.Errorf("got %v %s", ev.Op, ev.Name)
+	}
+	if err = s.Remove("/w/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, w); ev.Op != fsp.WatchDelete || ev.Name != "/w/new.txt" {
+		t.Errorf("got %v %s", ev.Op, ev.Name)
+	}
+	w.Close()
+	if ev, ok := <-w.Events; ok {
+		t.Errorf("event %v %s after Close", ev.Op, ev.Name)
+	}
+	w.Close()
+}
+
+func TestWatchStability(t *testing.T) {
+	var srv, s = startServer(t)
+	srv.Mkdir("/w")
+	w, err := s.Watch("/w", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetStability(time.Hour)
+	srv.WriteFile("/w/partial.bin", []byte("half"), time.Now())
+	select {
+	case ev := <-w.Events:
+		t.Fatalf("unstable file reported, %v %s", ev.Op, ev.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+	w.SetStability(0)
+	if ev := nextEvent(t, w); ev.Op != fsp.WatchCreate || ev.Name != "/w/partial.bin" {
+		t.Errorf("got %v %s", ev.Op, ev.Name)
+	}
+}
+
+func TestWatchMissingDir(t *testing.T) {
+	var _, s = startServer(t)
+	if w, err := s.Watch("/missing", time.Second); err == nil || w != nil {
+		t.Errorf("got %v, %v", w, err)
+	}
+}